@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cleafy/promqueen/store"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage/metric"
+	"github.com/sirupsen/logrus"
+)
+
+// QueryPath is the path prefix of the query API
+const QueryPath = "/api/v1/"
+
+// maxPoints limits the points per series returned by a range query, as
+// Prometheus does
+const maxPoints = 11000
+
+type errorType string
+
+const (
+	errorTimeout  errorType = "timeout"
+	errorCanceled errorType = "canceled"
+	errorExec     errorType = "execution"
+	errorBadData  errorType = "bad_data"
+)
+
+type apiError struct {
+	typ errorType
+	err error
+}
+
+type response struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType errorType   `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type queryData struct {
+	ResultType model.ValueType `json:"resultType"`
+	Result     model.Value     `json:"result"`
+}
+
+type queryAPI struct {
+	store  *store.Store
+	engine *promql.Engine
+	now    func() model.Time
+}
+
+// Query returns the handler of the Prometheus query API under QueryPath:
+//  - query and query_range evaluate PromQL expressions
+//  - series returns the series matching the match[] selectors
+//  - labels and label/<name>/values return the label names and values
+func Query(s *store.Store) http.Handler {
+	return &queryAPI{
+		store:  s,
+		engine: promql.NewEngine(s, nil),
+		now:    model.Now,
+	}
+}
+
+func (api *queryAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var data interface{}
+	var apiErr *apiError
+	path := strings.TrimPrefix(r.URL.Path, QueryPath)
+	switch {
+	case path == "query":
+		data, apiErr = api.query(r)
+	case path == "query_range":
+		data, apiErr = api.queryRange(r)
+	case path == "series":
+		data, apiErr = api.series(r)
+	case path == "labels":
+		data = api.store.LabelNames()
+	case strings.HasPrefix(path, "label/") && strings.HasSuffix(path, "/values"):
+		data, apiErr = api.labelValues(r, strings.TrimSuffix(strings.TrimPrefix(path, "label/"), "/values"))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := &response{Status: "success", Data: data}
+	if apiErr != nil {
+		resp = &response{Status: "error", ErrorType: apiErr.typ, Error: apiErr.err.Error()}
+		switch apiErr.typ {
+		case errorBadData:
+			w.WriteHeader(http.StatusBadRequest)
+		case errorTimeout:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logrus.Errorf("Error writing the %s response: %v", path, err)
+	}
+}
+
+func (api *queryAPI) query(r *http.Request) (interface{}, *apiError) {
+	ts := api.now()
+	if t := r.FormValue("time"); t != "" {
+		var err error
+		if ts, err = ParseTime(t); err != nil {
+			return nil, &apiError{errorBadData, err}
+		}
+	}
+
+	qry, err := api.engine.NewInstantQuery(r.FormValue("query"), ts)
+	if err != nil {
+		return nil, &apiError{errorBadData, err}
+	}
+	return exec(r, qry)
+}
+
+func (api *queryAPI) queryRange(r *http.Request) (interface{}, *apiError) {
+	start, err := ParseTime(r.FormValue("start"))
+	if err != nil {
+		return nil, &apiError{errorBadData, err}
+	}
+	end, err := ParseTime(r.FormValue("end"))
+	if err != nil {
+		return nil, &apiError{errorBadData, err}
+	}
+	if end.Before(start) {
+		return nil, &apiError{errorBadData, errors.New("end timestamp must not be before start time")}
+	}
+	step, err := ParseDuration(r.FormValue("step"))
+	if err != nil {
+		return nil, &apiError{errorBadData, err}
+	}
+	if step <= 0 {
+		return nil, &apiError{errorBadData, errors.New("zero or negative query resolution step widths are not accepted")}
+	}
+	if end.Sub(start)/step > maxPoints {
+		return nil, &apiError{errorBadData, fmt.Errorf("exceeded maximum resolution of %d points per timeseries", maxPoints)}
+	}
+
+	qry, err := api.engine.NewRangeQuery(r.FormValue("query"), start, end, step)
+	if err != nil {
+		return nil, &apiError{errorBadData, err}
+	}
+	return exec(r, qry)
+}
+
+func exec(r *http.Request, qry promql.Query) (interface{}, *apiError) {
+	res := qry.Exec(r.Context())
+	if res.Err != nil {
+		switch res.Err.(type) {
+		case promql.ErrQueryCanceled:
+			return nil, &apiError{errorCanceled, res.Err}
+		case promql.ErrQueryTimeout:
+			return nil, &apiError{errorTimeout, res.Err}
+		}
+		return nil, &apiError{errorExec, res.Err}
+	}
+	return &queryData{ResultType: res.Value.Type(), Result: res.Value}, nil
+}
+
+func (api *queryAPI) series(r *http.Request) (interface{}, *apiError) {
+	r.ParseForm()
+	if len(r.Form["match[]"]) == 0 {
+		return nil, &apiError{errorBadData, errors.New("no match[] parameter provided")}
+	}
+	start, end := model.Earliest, model.Latest
+	var err error
+	if t := r.FormValue("start"); t != "" {
+		if start, err = ParseTime(t); err != nil {
+			return nil, &apiError{errorBadData, err}
+		}
+	}
+	if t := r.FormValue("end"); t != "" {
+		if end, err = ParseTime(t); err != nil {
+			return nil, &apiError{errorBadData, err}
+		}
+	}
+
+	var matcherSets []metric.LabelMatchers
+	for _, s := range r.Form["match[]"] {
+		matchers, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			return nil, &apiError{errorBadData, err}
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	q, _ := api.store.Querier()
+	res, err := q.MetricsForLabelMatchers(r.Context(), start, end, matcherSets...)
+	if err != nil {
+		return nil, &apiError{errorExec, err}
+	}
+	metrics := make([]model.Metric, 0, len(res))
+	for _, m := range res {
+		metrics = append(metrics, m.Metric)
+	}
+	return metrics, nil
+}
+
+func (api *queryAPI) labelValues(r *http.Request, name string) (interface{}, *apiError) {
+	if !model.LabelNameRE.MatchString(name) {
+		return nil, &apiError{errorBadData, fmt.Errorf("invalid label name: %q", name)}
+	}
+	q, _ := api.store.Querier()
+	values, err := q.LabelValuesForLabelName(r.Context(), model.LabelName(name))
+	if err != nil {
+		return nil, &apiError{errorExec, err}
+	}
+	return values, nil
+}
+
+// ParseTime parses Unix timestamps in seconds (with decimals) and RFC3339
+func ParseTime(s string) (model.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		return model.TimeFromUnixNano(int64(t * float64(time.Second))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return model.TimeFromUnixNano(t.UnixNano()), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// ParseDuration parses durations in seconds (with decimals) and Prometheus
+// durations (eg. 5m)
+func ParseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
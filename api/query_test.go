@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, path string, params url.Values) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	Query(testStore()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil))
+	var resp map[string]interface{}
+	assert.Empty(t, json.Unmarshal(w.Body.Bytes(), &resp), "the response should be JSON")
+	return w.Code, resp
+}
+
+func TestQuery(t *testing.T) {
+	code, resp := get(t, "/api/v1/query", url.Values{"query": {"sum(up)"}, "time": {"1.5"}})
+	assert.Equal(t, http.StatusOK, code, "the query should succeed")
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, "vector", data["resultType"], "an instant vector should be returned")
+	assert.Equal(t, []interface{}{map[string]interface{}{"metric": map[string]interface{}{}, "value": []interface{}{1.5, "2"}}},
+		data["result"], "the last samples of the series should be summed")
+
+	code, resp = get(t, "/api/v1/query_range", url.Values{"query": {`up{job="app"}`}, "start": {"1"}, "end": {"2"}, "step": {"1s"}})
+	assert.Equal(t, http.StatusOK, code, "the range query should succeed")
+	data = resp["data"].(map[string]interface{})
+	assert.Equal(t, "matrix", data["resultType"], "a range vector should be returned")
+	assert.Equal(t, []interface{}{[]interface{}{float64(1), "1"}, []interface{}{float64(2), "0"}},
+		data["result"].([]interface{})[0].(map[string]interface{})["values"], "a value should be returned at every step")
+
+	code, resp = get(t, "/api/v1/query", url.Values{"query": {"sum("}})
+	assert.Equal(t, http.StatusBadRequest, code, "malformed queries should be rejected")
+	assert.Equal(t, "bad_data", resp["errorType"], "the error type should be returned")
+}
+
+func TestSeriesAndLabels(t *testing.T) {
+	code, resp := get(t, "/api/v1/series", url.Values{"match[]": {`{job="db"}`}})
+	assert.Equal(t, http.StatusOK, code, "the series request should succeed")
+	assert.Equal(t, []interface{}{map[string]interface{}{"__name__": "up", "job": "db", "url": "http://b/metrics"}},
+		resp["data"], "the matching series should be returned")
+
+	_, resp = get(t, "/api/v1/labels", nil)
+	assert.Equal(t, []interface{}{"__name__", "job", "url"}, resp["data"], "the label names should be returned")
+
+	_, resp = get(t, "/api/v1/label/job/values", nil)
+	assert.Equal(t, []interface{}{"app", "db"}, resp["data"], "the label values should be returned")
+}
@@ -0,0 +1,88 @@
+// Package api serves the recordings loaded in a store through the Prometheus
+// HTTP APIs.
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Cleafy/promqueen/prompb"
+	"github.com/Cleafy/promqueen/store"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/metric"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadPath is the path of the remote read API
+const ReadPath = "/api/v1/read"
+
+// Read returns the handler of the remote read API: the snappy compressed
+// protobuf ReadRequest is answered with the samples of the store, the
+// streamed response type is not supported
+func Read(s *store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req prompb.ReadRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := &prompb.ReadResponse{Results: make([]*prompb.QueryResult, 0, len(req.Queries))}
+		for _, query := range req.Queries {
+			result, err := read(s, query)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp.Results = append(resp.Results, result)
+		}
+
+		data, err = proto.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		if _, err := w.Write(snappy.Encode(nil, data)); err != nil {
+			logrus.Errorf("Error writing the remote read response: %v", err)
+		}
+	})
+}
+
+// read selects the series of the query from the store
+func read(s *store.Store, query *prompb.Query) (*prompb.QueryResult, error) {
+	matchers := make([]*metric.LabelMatcher, 0, len(query.Matchers))
+	for _, m := range query.Matchers {
+		matcher, err := metric.NewLabelMatcher(metric.MatchType(m.Type), model.LabelName(m.Name), model.LabelValue(m.Value))
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	result := &prompb.QueryResult{}
+	for _, series := range s.Select(model.Time(query.StartTimestampMs), model.Time(query.EndTimestampMs), matchers...) {
+		ts := &prompb.TimeSeries{
+			Labels:  prompb.LabelsFromMetric(series.Metric),
+			Samples: make([]*prompb.Sample, 0, len(series.Samples)),
+		}
+		for _, sample := range series.Samples {
+			ts.Samples = append(ts.Samples, &prompb.Sample{Value: float64(sample.Value), Timestamp: int64(sample.Timestamp)})
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, nil
+}
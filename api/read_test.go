@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Cleafy/promqueen/prompb"
+	"github.com/Cleafy/promqueen/store"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore() *store.Store {
+	s := store.New()
+	s.Append(model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app", "url": "http://a/metrics"}, Value: 1, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "app", "url": "http://a/metrics"}, Value: 0, Timestamp: 2000},
+		{Metric: model.Metric{"__name__": "up", "job": "db", "url": "http://b/metrics"}, Value: 1, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "temperature", "job": "app", "url": "http://a/metrics"}, Value: 21.5, Timestamp: 1000},
+	})
+	return s
+}
+
+func TestRead(t *testing.T) {
+	data, _ := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1500,
+		EndTimestampMs:   3000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.MatchEqual, Name: "__name__", Value: "up"},
+			{Type: prompb.MatchRegexp, Name: "job", Value: "a.*"},
+		},
+	}}})
+	w := httptest.NewRecorder()
+	Read(testStore()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, ReadPath, bytes.NewReader(snappy.Encode(nil, data))))
+	assert.Equal(t, http.StatusOK, w.Code, "the request should succeed")
+	assert.Equal(t, "snappy", w.Header().Get("Content-Encoding"), "the response should be compressed")
+
+	body, _ := ioutil.ReadAll(w.Body)
+	data, err := snappy.Decode(nil, body)
+	assert.Empty(t, err, "the response should be snappy compressed")
+	var resp prompb.ReadResponse
+	assert.Empty(t, proto.Unmarshal(data, &resp), "the response should be a ReadResponse")
+	assert.Equal(t, 1, len(resp.Results), "a result should be returned for every query")
+	assert.Equal(t, 1, len(resp.Results[0].Timeseries), "the matching series should be returned")
+	ts := resp.Results[0].Timeseries[0]
+	assert.Equal(t, model.Metric{"__name__": "up", "job": "app", "url": "http://a/metrics"}, prompb.MetricFromLabels(ts.Labels), "the labels should be returned")
+	assert.Equal(t, []*prompb.Sample{{Value: 0, Timestamp: 2000}}, ts.Samples, "the samples in the range should be returned")
+}
+
+func TestReadBadRequest(t *testing.T) {
+	w := httptest.NewRecorder()
+	Read(testStore()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, ReadPath, bytes.NewBufferString("not snappy")))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "malformed requests should be rejected")
+}
@@ -3,23 +3,36 @@ package main
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/Cleafy/promqueen/api"
+	"github.com/Cleafy/promqueen/blocks"
 	cm "github.com/Cleafy/promqueen/model"
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/Cleafy/promqueen/replay"
+	"github.com/Cleafy/promqueen/sink"
+	"github.com/Cleafy/promqueen/store"
 
 	"github.com/mattetti/filebuffer"
-	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage/local"
+	"github.com/prometheus/prometheus/storage/metric"
 	"github.com/sirupsen/logrus"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 	pb "gopkg.in/cheggaaa/pb.v2"
@@ -44,7 +57,61 @@ var (
 	dir               = kingpin.Flag("dir", "Input directory.").Short('d').OverrideDefaultFromEnvar("INPUT_DIRECTORY").Default(".").String()
 	memoryChunk       = kingpin.Flag("memoryChunk", "Maximum number of chunks in memory").Default("100000000").Int()
 	maxChunkToPersist = kingpin.Flag("maxChunkToPersist", "Maximum number of chunks waiting, in memory, to be written on the disk").Default("10000").Int()
+	sinkName          = kingpin.Flag("sink", "Output to backfill: local (Prometheus 1.x local storage under --storage.path), tsdb (Prometheus 2.x TSDB blocks under --storage.path), remote_write, openmetrics (file for promtool, see --output), influx (line protocol to --output or --influx.url), victoriametrics (import format to --output or --victoriametrics.url), graphite (plaintext to --output or --graphite.address), otlp (OTLP/JSON to --output or --otlp.url), csv, jsonl or parquet (tables for data analysis to --output)").Default("local").Enum("local", "tsdb", "remote_write", "openmetrics", "influx", "victoriametrics", "graphite", "otlp", "csv", "jsonl", "parquet")
+	outputPath        = kingpin.Flag("output", "Output file of the file sinks, - for the standard output").Short('o').Default("-").String()
+	tsdbBlockDuration = kingpin.Flag("tsdb.block-duration", "Range of the TSDB blocks, aligned as Prometheus does").Default(blocks.DefaultBlockDuration.String()).Duration()
+	rwURL             = kingpin.Flag("remote-write.url", "URL of the remote write endpoint (eg. http://mimir:8080/api/v1/push)").String()
+	rwHeaders         = kingpin.Flag("remote-write.header", "Extra headers sent with the remote write requests [eg. X-Scope-OrgID=tenant]").StringMap()
+	rwTimeout         = kingpin.Flag("remote-write.timeout", "Timeout of the remote write requests").Default("30s").Duration()
+	rwShards          = kingpin.Flag("remote-write.shards", "Number of concurrent remote write requests").Default("4").Int()
+	rwBatchSize       = kingpin.Flag("remote-write.batch-size", "Maximum number of samples per remote write request").Default("2000").Int()
+	rwMaxRetries      = kingpin.Flag("remote-write.max-retries", "Retries of the remote write requests failing with 5xx/429 or network errors").Default("10").Int()
+	influxURL         = kingpin.Flag("influx.url", "InfluxDB write API URL (eg. http://influx:8086/write?db=prom), the line protocol is written to --output when missing").String()
+	influxHeaders     = kingpin.Flag("influx.header", "Extra headers sent with the InfluxDB requests [eg. Authorization=Token xxx]").StringMap()
+	influxMeasurement = kingpin.Flag("influx.measurement", "Measurement template, $label expands to the label value and $__name__ to the metric name").Default("$__name__").String()
+	influxField       = kingpin.Flag("influx.field", "Field template, $label expands to the label value and $__name__ to the metric name").Default("value").String()
+	influxBatchSize   = kingpin.Flag("influx.batch-size", "Maximum number of lines per InfluxDB request").Default("5000").Int()
+	vmURL             = kingpin.Flag("victoriametrics.url", "VictoriaMetrics import API URL (eg. http://victoria:8428/api/v1/import), the lines are written to --output when missing").String()
+	vmHeaders         = kingpin.Flag("victoriametrics.header", "Extra headers sent with the VictoriaMetrics requests [eg. Authorization=Bearer xxx]").StringMap()
+	vmBatchSize       = kingpin.Flag("victoriametrics.batch-size", "Maximum number of samples per VictoriaMetrics request").Default("10000").Int()
+	graphiteAddress   = kingpin.Flag("graphite.address", "Carbon plaintext TCP address (eg. carbon:2003), the lines are written to --output when missing").String()
+	graphiteTemplate  = kingpin.Flag("graphite.template", "Path template, $label expands to the label value and $__name__ to the metric name; by default the metric name followed by every label name and value").String()
+	graphiteTagged    = kingpin.Flag("graphite.tagged", "Write the labels not used by --graphite.template as Graphite tags").Bool()
+	graphiteRetries   = kingpin.Flag("graphite.max-retries", "Reconnections to carbon, writing the batch again, when writing a batch fails").Default("10").Int()
+	otlpURL           = kingpin.Flag("otlp.url", "OTLP/HTTP metrics endpoint (eg. http://collector:4318/v1/metrics), the requests are written to --output when missing").String()
+	otlpHeaders       = kingpin.Flag("otlp.header", "Extra headers sent with the OTLP requests [eg. Authorization=Bearer xxx]").StringMap()
+	tableLayout       = kingpin.Flag("table.layout", "Layout of the csv and jsonl sinks: long (a row per sample) or wide (a row per timestamp, a column per series)").Default(sink.LayoutLong).Enum(sink.LayoutLong, sink.LayoutWide)
+	tableMetric       = kingpin.Flag("table.metric", "Regex the metric names played back have to match, a shorthand of --filter.match for the csv and jsonl exports").String()
+	tableLabels       = kingpin.Flag("table.label", "Regex the label values played back have to match, a shorthand of --filter.match for the csv and jsonl exports [eg. job=node.*]").StringMap()
+	parquetLabels     = kingpin.Flag("parquet.label", "Label promoted to its own column of the parquet sink, instead of the labels map [eg. job]").Strings()
+	parquetRowGroup   = kingpin.Flag("parquet.row-group-size", "Size of the parquet row groups").Default("128MB").Bytes()
+	parquetCompress   = kingpin.Flag("parquet.compression", "Compression of the parquet pages: none, snappy, gzip or zstd").Default("snappy").Enum("none", "snappy", "gzip", "zstd")
+	backfillCmd       = kingpin.Command("backfill", "Backfill the recordings into the --sink output").Default()
+	serveCmd          = kingpin.Command("serve", "Serve the recordings as live /metrics endpoints, one per recorded service")
+	serveAddress      = serveCmd.Flag("listen-address", "Address the endpoints are served on").Default(":9099").String()
+	serveSpeed        = serveCmd.Flag("speed", "Replay speed multiplier, 1 plays the frames at the pace they were recorded").Default("1").Float64()
+	serveLoop         = serveCmd.Flag("loop", "Start over from the first frame once the last one is served").Bool()
+	apiCmd            = kingpin.Command("api", "Serve the recordings through the Prometheus query and remote read APIs, without backfilling them")
+	apiAddress        = apiCmd.Flag("listen-address", "Address the API is served on").Default(":9201").String()
+	queryCmd          = kingpin.Command("query", "Evaluate a PromQL expression over the recordings, without backfilling them")
+	queryExpr         = queryCmd.Arg("expression", "PromQL expression to evaluate").Required().String()
+	queryTime         = queryCmd.Flag("time", "Evaluation time of the instant query (see --start), the newest recorded sample by default").String()
+	queryStep         = queryCmd.Flag("step", "Resolution of the range query").Default("1m").String()
+	queryFormat       = queryCmd.Flag("format", "Output format of the result: table or json").Default("table").Enum("table", "json")
+	filterName        = kingpin.Flag("filter.name", "Regex the Name of the frames played back has to match").String()
+	filterURI         = kingpin.Flag("filter.uri", "Regex the URI of the frames played back has to match").String()
+	filterMatch       = kingpin.Flag("filter.match", "Series selector the series played back have to match, repeat for any of several [eg. {__name__=~\"http_.*\",code=\"500\"}]").Strings()
+	start             = kingpin.Flag("start", "Time of the first frame played back, after --shift and --rebase: now, relative to now (eg. -2h), RFC3339 or Unix timestamp; the start of the range query of the query command").String()
+	end               = kingpin.Flag("end", "Time of the last frame played back (see --start); the end of the range query of the query command").String()
+	shift             = kingpin.Flag("shift", "Duration all the timestamps are moved by, truncated to the second [eg. 720h or -1h]").Default("0s").Duration()
+	rebase            = kingpin.Flag("rebase", "Time the oldest frame of all the files is moved to, the others keeping their distance from it (see --start)").String()
+	honorTimestamps   = kingpin.Flag("honor-timestamps", "Keep the timestamps exposed by the targets, --no-honor-timestamps uses the frame timestamp for every sample").Default("true").Bool()
 	framereader       = make(<-chan cm.Frame)
+	framefiles        []*os.File
+	firstTimestamp    int64
+	unpackDir         string
+	rebaseTime        model.Time
+	filter            *playback.Filter
 	Version           = "0.0.10"
 	cfgMemoryStorage  = local.MemorySeriesStorageOptions{
 		MemoryChunks:       0,
@@ -67,7 +134,10 @@ func osfile2fname(fss []os.FileInfo, dir string) []string {
 	return out
 }
 
-func generateFramereader() int {
+// generateFramereader reads the recordings in --dir, returning the number of
+// frames passing the filter. When shift is set the frames are filtered by
+// their time once moved by --shift and --rebase.
+func generateFramereader(shift bool) int {
 	defer func() {
 		if e := recover(); e != nil {
 			logrus.Errorf("Frame reader generation failed!, MESSAGE: %v", e)
@@ -75,7 +145,12 @@ func generateFramereader() int {
 	}()
 
 	logrus.Infoln("Preliminary file read started...")
-	var count int = 0
+	for _, f := range framefiles {
+		f.Close()
+	}
+	framefiles = nil
+	firstTimestamp = 0
+	var frames []*cm.Frame
 	// 1. Check for every file that is GZip or csave format and create the filemap
 	files, err := ioutil.ReadDir(*dir)
 	if err != nil {
@@ -97,81 +172,158 @@ func generateFramereader() int {
 		}
 		if ftype.MIME.Value == "application/replay" {
 			f, _ := os.Open(path)
-
-			count += len(cm.ReadAll(f).Data)
-			f.Seek(0, 0)
-
+			framefiles = append(framefiles, f)
+			frames = append(frames, readFrames(f)...)
 			readers = append(readers, f)
 		}
 		if ftype.MIME.Value == "application/gzip" {
-			filename := filepath.Base(path)
-			ungzip(path, "./tmp/"+trimSuffix(filename, ".gz"))
-
-			f, _ := os.Open("./tmp/" + trimSuffix(filename, ".gz"))
-
-			count += len(cm.ReadAll(f).Data)
-			f.Seek(0, 0)
+			if unpackDir == "" {
+				if unpackDir, err = ioutil.TempDir("", "promplay"); err != nil {
+					panic(err)
+				}
+			}
+			target := filepath.Join(unpackDir, trimSuffix(filepath.Base(path), ".gz"))
+			ungzip(path, target)
 
+			f, _ := os.Open(target)
+			framefiles = append(framefiles, f)
+			frames = append(frames, readFrames(f)...)
 			readers = append(readers, f)
 		}
 	}
-	framereader = cm.NewMultiReader(readers)
+	if shift {
+		filter.Offset = timeOffset()
+	}
+	count := 0
+	for _, frame := range frames {
+		if filter.Frame(frame) {
+			count++
+		}
+	}
+	framereader = filter.Frames(cm.NewMultiReader(readers))
 	return count
 }
 
-func trimSuffix(s, suffix string) string {
-	if strings.HasSuffix(s, suffix) {
-		s = s[:len(s)-len(suffix)]
+// readFrames returns the headers of the frames of the file, keeping track of
+// the oldest frame timestamp, and rewinds it
+func readFrames(f *os.File) []*cm.Frame {
+	var frames []*cm.Frame
+	for _, frame := range cm.ReadAll(f).Data {
+		if firstTimestamp == 0 || frame.Header.Timestamp < firstTimestamp {
+			firstTimestamp = frame.Header.Timestamp
+		}
+		frames = append(frames, &cm.Frame{Header: frame.Header})
 	}
-	return s
+	f.Seek(0, 0)
+	return frames
 }
 
-func updateURLTimestamp(timestamp int64, name string, url string, body io.Reader) io.Reader {
-	dec := expfmt.NewDecoder(body, expfmt.FmtText)
-	pr, pw := io.Pipe()
-	enc := expfmt.NewEncoder(pw, expfmt.FmtText)
-	//ts := timestamp * 1000
+// timeOffset returns the offset the timestamps are moved by: --shift, plus
+// the distance between the oldest frame of all the files and --rebase
+func timeOffset() time.Duration {
+	if rebaseTime == 0 || firstTimestamp == 0 {
+		return *shift
+	}
+	return *shift + rebaseTime.Sub(model.TimeFromUnix(firstTimestamp))
+}
 
-	go func() {
-		count := 0
+// parseTime parses the times of the flags: now, a duration relative to now
+// (eg. -2h), RFC3339 or a Unix timestamp
+func parseTime(s string) (model.Time, error) {
+	now := model.Now()
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "-") {
+		if d, err := model.ParseDuration(s[1:]); err == nil {
+			return now.Add(-time.Duration(d)), nil
+		}
+	}
+	return api.ParseTime(s)
+}
 
-		for {
-			var metrics dto.MetricFamily
-			err := dec.Decode(&metrics)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				logrus.Error(err)
-				break
+// newFilter generates the playback filter of the --filter.* and --table.*
+// flags, and of --start and --end unless they are the range of the query
+// command
+func newFilter(command string) (*playback.Filter, error) {
+	f := &playback.Filter{}
+	var err error
+	if *filterName != "" {
+		if f.Name, err = regexp.Compile("^(?:" + *filterName + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	if *filterURI != "" {
+		if f.URI, err = regexp.Compile("^(?:" + *filterURI + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	if command != queryCmd.FullCommand() {
+		if *start != "" {
+			if f.Start, err = parseTime(*start); err != nil {
+				return nil, err
 			}
-
-			lpName := "job"
-			urlName := "url"
-
-			for _, metric := range metrics.GetMetric() {
-				lp := dto.LabelPair{
-					Name:  &lpName,
-					Value: &name,
-				}
-				metric.Label = append(metric.Label, &lp)
-				urlp := dto.LabelPair{
-					Name:  &urlName,
-					Value: &url,
-				}
-				metric.Label = append(metric.Label, &urlp)
+		}
+		if *end != "" {
+			if f.End, err = parseTime(*end); err != nil {
+				return nil, err
 			}
+		}
+	}
+	for _, selector := range *filterMatch {
+		matchers, err := promql.ParseMetricSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		f.Matchers = append(f.Matchers, matchers)
+	}
 
-			enc.Encode(&metrics)
-
-			count++
+	// --table.metric and --table.label restrict every --filter.match selector
+	var table metric.LabelMatchers
+	if *tableMetric != "" {
+		matcher, err := metric.NewLabelMatcher(metric.RegexMatch, model.MetricNameLabel, model.LabelValue(*tableMetric))
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, matcher)
+	}
+	for name, re := range *tableLabels {
+		matcher, err := metric.NewLabelMatcher(metric.RegexMatch, model.LabelName(name), model.LabelValue(re))
+		if err != nil {
+			return nil, err
 		}
+		table = append(table, matcher)
+	}
+	if len(table) > 0 {
+		if len(f.Matchers) == 0 {
+			f.Matchers = []metric.LabelMatchers{nil}
+		}
+		for i := range f.Matchers {
+			f.Matchers[i] = append(f.Matchers[i], table...)
+		}
+	}
+	return f, nil
+}
 
-		logrus.Printf("%d metrics unmarshalled for %s", count, url)
-		pw.Close()
-	}()
+// removeUnpackDir removes the directory of the unpacked gzipped files, if any
+func removeUnpackDir() {
+	if unpackDir != "" {
+		os.RemoveAll(unpackDir)
+	}
+}
 
-	return pr
+// exit exits with the code once the unpacked files are removed, as os.Exit
+// skips the deferred calls
+func exit(code int) {
+	removeUnpackDir()
+	os.Exit(code)
+}
+
+func trimSuffix(s, suffix string) string {
+	if strings.HasSuffix(s, suffix) {
+		s = s[:len(s)-len(suffix)]
+	}
+	return s
 }
 
 func ungzip(source, target string) {
@@ -206,62 +358,233 @@ func ungzip(source, target string) {
 	}
 }
 
-func main() {
-
-	kingpin.Version(Version)
+// newSink opens the output selected by --sink
+func newSink(name string) (sink.Sink, error) {
+	switch name {
+	case "tsdb":
+		return sink.NewTSDB(cfgMemoryStorage.PersistenceStoragePath, *tsdbBlockDuration)
+	case "openmetrics":
+		return sink.NewOpenMetrics(*outputPath), nil
+	case "influx":
+		return sink.NewInflux(sink.InfluxOptions{
+			Measurement: *influxMeasurement,
+			Field:       *influxField,
+			Output:      *outputPath,
+			URL:         *influxURL,
+			Headers:     *influxHeaders,
+			Timeout:     30 * time.Second,
+			BatchSize:   *influxBatchSize,
+		})
+	case "victoriametrics":
+		return sink.NewVictoriaMetrics(sink.VictoriaMetricsOptions{
+			Output:    *outputPath,
+			URL:       *vmURL,
+			Headers:   *vmHeaders,
+			Timeout:   30 * time.Second,
+			BatchSize: *vmBatchSize,
+		})
+	case "graphite":
+		return sink.NewGraphite(sink.GraphiteOptions{
+			Template:   *graphiteTemplate,
+			Tagged:     *graphiteTagged,
+			Output:     *outputPath,
+			Address:    *graphiteAddress,
+			Timeout:    30 * time.Second,
+			MaxRetries: *graphiteRetries,
+			MinBackoff: 30 * time.Millisecond,
+			MaxBackoff: 5 * time.Second,
+		})
+	case "otlp":
+		return sink.NewOTLP(sink.OTLPOptions{
+			Output:  *outputPath,
+			URL:     *otlpURL,
+			Headers: *otlpHeaders,
+			Timeout: 30 * time.Second,
+		})
+	case "csv", "jsonl":
+		return sink.NewTable(sink.TableOptions{
+			Format: name,
+			Layout: *tableLayout,
+			Output: *outputPath,
+		})
+	case "parquet":
+		return sink.NewParquet(sink.ParquetOptions{
+			Output:       *outputPath,
+			Labels:       *parquetLabels,
+			RowGroupSize: int64(*parquetRowGroup),
+			Compression:  *parquetCompress,
+		})
+	case "remote_write":
+		if *rwURL == "" {
+			return nil, errors.New("--remote-write.url is required")
+		}
+		return sink.NewRemoteWrite(sink.RemoteWriteOptions{
+			URL:        *rwURL,
+			Timeout:    *rwTimeout,
+			Headers:    *rwHeaders,
+			Shards:     *rwShards,
+			BatchSize:  *rwBatchSize,
+			MaxRetries: *rwMaxRetries,
+			MinBackoff: 30 * time.Millisecond,
+			MaxBackoff: 5 * time.Second,
+		}), nil
+	default:
+		cfgMemoryStorage.MaxChunksToPersist = *maxChunkToPersist
+		cfgMemoryStorage.MemoryChunks = *memoryChunk
+		return sink.NewLocal(&cfgMemoryStorage)
+	}
+}
 
-	kingpin.Flag("storage.path", "Directory path to create and fill the data store under.").Default("data").StringVar(&cfgMemoryStorage.PersistenceStoragePath)
-	kingpin.Flag("storage.retention-period", "Period of time to store data for").Default("360h").DurationVar(&cfgMemoryStorage.PersistenceRetentionPeriod)
+// serve plays the recordings on the replay server until the last frame, or
+// forever with --loop
+func serve() {
+	server := replay.NewServer(func() <-chan cm.Frame {
+		generateFramereader(false)
+		return framereader
+	}, replay.Options{Speed: *serveSpeed, Loop: *serveLoop})
 
-	kingpin.Flag("storage.checkpoint-interval", "Period of time to store data for").Default("30m").DurationVar(&cfgMemoryStorage.CheckpointInterval)
-	kingpin.Flag("storage.checkpoint-dirty-series-limit", "Period of time to store data for").Default("10000").IntVar(&cfgMemoryStorage.CheckpointDirtySeriesLimit)
+	listener, err := net.Listen("tcp", *serveAddress)
+	if err != nil {
+		logrus.Errorf("Error listening on %s: %v", *serveAddress, err)
+		exit(1)
+	}
+	go http.Serve(listener, server)
+	logrus.Infof("Serving the recordings on %s%s<name>", *serveAddress, replay.PathPrefix)
 
-	kingpin.Parse()
+	server.Run(context.Background())
+}
 
-	if *debug {
-		logrus.SetLevel(logrus.DebugLevel)
-		flag.Set("log.level", "debug")
+// serveAPI loads the recordings in memory and serves them through the
+// query and remote read APIs
+func serveAPI() {
+	generateFramereader(true)
+	s := store.Load(framereader, store.Options{HonorTimestamps: *honorTimestamps, Offset: timeOffset(), Filter: filter})
+
+	mux := http.NewServeMux()
+	mux.Handle(api.QueryPath, api.Query(s))
+	mux.Handle(api.ReadPath, api.Read(s))
+	logrus.Infof("Serving the query API on %s%s and the remote read API on %s%s", *apiAddress, api.QueryPath, *apiAddress, api.ReadPath)
+	if err := http.ListenAndServe(*apiAddress, mux); err != nil {
+		logrus.Errorf("Error serving the API on %s: %v", *apiAddress, err)
+		exit(1)
 	}
+}
 
-	if !*verbose {
-		logrus.SetLevel(logrus.ErrorLevel)
-		flag.Set("log.level", "error")
+// query evaluates the expression over the recordings loaded in memory: a
+// range query when --start or --end are set, an instant one otherwise
+func query(w io.Writer) error {
+	generateFramereader(true)
+	s := store.Load(framereader, store.Options{HonorTimestamps: *honorTimestamps, Offset: timeOffset(), Filter: filter})
+	oldest, newest := s.Bounds()
+
+	parse := func(flag string, def model.Time) (model.Time, error) {
+		if flag == "" {
+			return def, nil
+		}
+		return parseTime(flag)
 	}
 
-	// create temp directory to store ungzipped files
-	os.Mkdir("./tmp", 0700)
-	defer os.RemoveAll("./tmp")
+	var qry promql.Query
+	engine := promql.NewEngine(s, nil)
+	if *start != "" || *end != "" {
+		from, err := parse(*start, oldest)
+		if err != nil {
+			return err
+		}
+		through, err := parse(*end, newest)
+		if err != nil {
+			return err
+		}
+		if through.Before(from) {
+			return errors.New("end timestamp must not be before start time")
+		}
+		step, err := api.ParseDuration(*queryStep)
+		if err != nil {
+			return err
+		}
+		if step <= 0 {
+			return errors.New("zero or negative query resolution step widths are not accepted")
+		}
+		if qry, err = engine.NewRangeQuery(*queryExpr, from, through, step); err != nil {
+			return err
+		}
+	} else {
+		ts, err := parse(*queryTime, newest)
+		if err != nil {
+			return err
+		}
+		if qry, err = engine.NewInstantQuery(*queryExpr, ts); err != nil {
+			return err
+		}
+	}
 
-	logrus.Infoln("Prefilling into", cfgMemoryStorage.PersistenceStoragePath)
+	res := qry.Exec(context.Background())
+	if res.Err != nil {
+		return res.Err
+	}
 
-	cfgMemoryStorage.MaxChunksToPersist = *maxChunkToPersist
-	cfgMemoryStorage.MemoryChunks = *memoryChunk
+	if *queryFormat == "json" {
+		return json.NewEncoder(w).Encode(map[string]interface{}{
+			"resultType": res.Value.Type(),
+			"result":     res.Value,
+		})
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tTIMESTAMP\tVALUE")
+	row := func(m model.Metric, ts model.Time, value string) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m, ts.Time().UTC().Format(time.RFC3339Nano), value)
+	}
+	switch value := res.Value.(type) {
+	case model.Vector:
+		for _, sample := range value {
+			row(sample.Metric, sample.Timestamp, sample.Value.String())
+		}
+	case model.Matrix:
+		for _, series := range value {
+			for _, pair := range series.Values {
+				row(series.Metric, pair.Timestamp, pair.Value.String())
+			}
+		}
+	case *model.Scalar:
+		row(model.Metric{}, value.Timestamp, value.Value.String())
+	case *model.String:
+		row(model.Metric{}, value.Timestamp, value.Value)
+	}
+	return tw.Flush()
+}
 
-	localStorage := local.NewMemorySeriesStorage(&cfgMemoryStorage)
+// backfill plays the recordings back into the --sink output. The sink is
+// closed on errors as well, so that the data written so far is kept.
+func backfill() (err error) {
+	count := generateFramereader(true)
+	offset := timeOffset()
+	if offset != 0 {
+		logrus.Infof("Moving the timestamps by %v", offset)
+	}
 
-	sampleAppender := localStorage
+	logrus.Infof("Prefilling into the %s sink", *sinkName)
 
-	logrus.Infoln("Starting the storage engine")
-	if err := localStorage.Start(); err != nil {
-		logrus.Errorln("Error opening memory series storage:", err)
-		os.Exit(1)
+	output, err := newSink(*sinkName)
+	if err != nil {
+		return fmt.Errorf("opening the %s sink: %v", *sinkName, err)
 	}
 	defer func() {
-		if err := localStorage.Stop(); err != nil {
-			logrus.Errorln("Error stopping storage:", err)
+		if cerr := output.Close(); cerr != nil {
+			if err == nil {
+				err = fmt.Errorf("closing the %s sink: %v", *sinkName, cerr)
+				return
+			}
+			logrus.Errorf("Error closing the %s sink: %v", *sinkName, cerr)
 		}
 	}()
 
-	filetype.AddMatcher(replayType, replayMatcher)
-
-	count := generateFramereader()
-
-	logrus.Debug("frameReader %+v", framereader)
+	logrus.Debugf("frameReader %+v", framereader)
 
 	sout := bufio.NewWriter(os.Stdout)
 	defer sout.Flush()
 
-	r := &http.Request{}
+	scrapeSeries := playback.NewScrapeSeries()
+	numExemplars, numHistograms := 0, 0
 
 	bar := pb.ProgressBarTemplate(`{{ red "Frames processed:" }} {{bar . | green}} {{rtime . "ETA %s" | blue }} {{percent . }}`).Start(count)
 	defer bar.Finish()
@@ -269,68 +592,115 @@ func main() {
 	for frame := range framereader {
 		bar.Increment()
 
-		response, err := http.ReadResponse(bufio.NewReader(filebuffer.New(frame.Data)), r)
-		if err != nil {
-			logrus.Errorf("Errors occured while reading frame %d, MESSAGE: %v", frame.NameString, err)
-			continue
+		scrape := &playback.Scrape{}
+		if frame.Header.Type == cm.FailureFrame {
+			if failure, err := frame.Failure(); err == nil {
+				logrus.Infof("Scrape of %s failed after %v (%s): %s", frame.URIString(), failure.Duration, failure.Kind, failure.Message)
+			}
+		} else {
+			var err error
+			if scrape, err = playback.Decode(&frame, *honorTimestamps); err != nil {
+				logrus.Errorf("Errors occured while reading frame %s, MESSAGE: %v", frame.NameString(), err)
+				continue
+			}
 		}
-		bytesReader := updateURLTimestamp(frame.Header.Timestamp, frame.NameString(), frame.URIString(), response.Body)
-
-		sdec := expfmt.SampleDecoder{
-			Dec: expfmt.NewDecoder(bytesReader, expfmt.FmtText),
-			Opts: &expfmt.DecodeOptions{
-				Timestamp: model.TimeFromUnix(frame.Header.Timestamp),
-			},
+		playback.Shift(&frame, scrape, offset)
+		synthetic := scrapeSeries.Samples(&frame, scrape)
+		filter.Scrape(scrape)
+
+		batch := (&sink.Batch{
+			Samples:    append(scrape.Samples, filter.Samples(synthetic)...),
+			Histograms: scrape.Histograms,
+			Exemplars:  scrape.Exemplars,
+			Metadata:   scrape.Metadata,
+		}).For(output.Capabilities())
+		numExemplars += len(scrape.Exemplars) - len(batch.Exemplars)
+		numHistograms += len(scrape.Histograms) - len(batch.Histograms)
+
+		logrus.Infoln("Ingested", len(batch.Samples), "metrics")
+
+		if err := output.Append(batch); err != nil {
+			return fmt.Errorf("writing to the %s sink: %v", *sinkName, err)
 		}
+	}
 
-		decSamples := make(model.Vector, 0, 1)
-		tempSamples := make(model.Vector, 0, 1)
+	if err := output.Flush(); err != nil {
+		return fmt.Errorf("flushing the %s sink: %v", *sinkName, err)
+	}
 
-		for err := sdec.Decode(&tempSamples); err == nil; err = sdec.Decode(&tempSamples) {
-			decSamples = append(decSamples, tempSamples...)
-		}
+	if numExemplars > 0 {
+		logrus.Infof("%d exemplars discarded, the output does not support them", numExemplars)
+	}
+	if numHistograms > 0 {
+		logrus.Infof("%d native histograms written as classic histograms, the output does not support them", numHistograms)
+	}
+	return nil
+}
 
-		logrus.Infoln("Ingested", len(decSamples), "metrics")
+func main() {
 
-		for sampleAppender.NeedsThrottling() {
-			logrus.Debugln("THROTTLING: Waiting 100ms for appender to be ready for more data")
-			time.Sleep(time.Millisecond * 100)
-		}
+	kingpin.Version(Version)
 
-		var (
-			numOutOfOrder = 0
-			numDuplicates = 0
-		)
+	kingpin.Flag("storage.path", "Directory path to create and fill the data store under.").Default("data").StringVar(&cfgMemoryStorage.PersistenceStoragePath)
+	kingpin.Flag("storage.retention-period", "Period of time to store data for").Default("360h").DurationVar(&cfgMemoryStorage.PersistenceRetentionPeriod)
 
-		for _, s := range model.Samples(decSamples) {
+	kingpin.Flag("storage.checkpoint-interval", "Period of time to store data for").Default("30m").DurationVar(&cfgMemoryStorage.CheckpointInterval)
+	kingpin.Flag("storage.checkpoint-dirty-series-limit", "Period of time to store data for").Default("10000").IntVar(&cfgMemoryStorage.CheckpointDirtySeriesLimit)
 
-			if err := sampleAppender.Append(s); err != nil {
-				switch err {
-				case local.ErrOutOfOrderSample:
-					numOutOfOrder++
-					logrus.WithFields(logrus.Fields{
-						"sample": s,
-						"error":  err,
-					}).Error("Sample discarded")
-				case local.ErrDuplicateSampleForTimestamp:
-					numDuplicates++
-					logrus.WithFields(logrus.Fields{
-						"sample": s,
-						"error":  err,
-					}).Error("Sample discarded")
-				default:
-					logrus.WithFields(logrus.Fields{
-						"sample": s,
-						"error":  err,
-					}).Error("Sample discarded")
-				}
-			}
+	command := kingpin.Parse()
+
+	if *debug {
+		logrus.SetLevel(logrus.DebugLevel)
+		flag.Set("log.level", "debug")
+	}
+
+	if !*verbose {
+		logrus.SetLevel(logrus.ErrorLevel)
+		flag.Set("log.level", "error")
+	}
+
+	// the gzipped files are unpacked into a temp directory, created with the
+	// first of them
+	defer removeUnpackDir()
+
+	filetype.AddMatcher(replayType, replayMatcher)
+
+	var err error
+	if filter, err = newFilter(command); err != nil {
+		logrus.Errorf("Error parsing the playback filters: %v", err)
+		exit(1)
+	}
+	if *rebase != "" {
+		if rebaseTime, err = parseTime(*rebase); err != nil {
+			logrus.Errorf("Error parsing --rebase: %v", err)
+			exit(1)
 		}
 	}
 
+	if command == serveCmd.FullCommand() {
+		serve()
+		return
+	}
+	if command == apiCmd.FullCommand() {
+		serveAPI()
+		return
+	}
+	if command == queryCmd.FullCommand() {
+		if err := query(os.Stdout); err != nil {
+			logrus.Errorf("Error evaluating %s: %v", *queryExpr, err)
+			exit(1)
+		}
+		return
+	}
+
+	if err := backfill(); err != nil {
+		logrus.Errorf("Backfill failed: %v", err)
+		exit(1)
+	}
+
 	// Generate the prometheus.yml in case it does not exist
 	promcfgpath := cfgMemoryStorage.PersistenceStoragePath + "/../prometheus.yml"
-	if _, err := os.Stat(promcfgpath); os.IsNotExist(err) && !*nopromcfg {
+	if _, err := os.Stat(promcfgpath); os.IsNotExist(err) && !*nopromcfg && (*sinkName == "local" || *sinkName == "tsdb") {
 		if err = ioutil.WriteFile(promcfgpath, []byte("global: {}"), os.ModeExclusive|0644); err != nil {
 			logrus.Error(err)
 		}
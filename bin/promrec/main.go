@@ -2,26 +2,38 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"time"
 
+	"github.com/Cleafy/promqueen/discovery"
 	"github.com/Cleafy/promqueen/model"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	debug      = kingpin.Flag("debug", "Enable debug mode.").Bool()
-	enableGZIP = kingpin.Flag("gzip", "Enable gzip mode.").Bool()
-	interval   = kingpin.Flag("interval", "Timeout waiting for ping.").Default("60s").OverrideDefaultFromEnvar("ACTION_INTERVAL").Short('i').Duration()
-	umap       = kingpin.Flag("umap", "stringmap [eg. service.name=http://get.uri:port/uri].").Short('u').StringMap()
-	output     = kingpin.Flag("output", "Output file.").Short('o').OverrideDefaultFromEnvar("OUTPUT_FILE").Default("metrics").String()
+	debug              = kingpin.Flag("debug", "Enable debug mode.").Bool()
+	enableGZIP         = kingpin.Flag("gzip", "Enable gzip mode.").Bool()
+	interval           = kingpin.Flag("interval", "Timeout waiting for ping.").Default("60s").OverrideDefaultFromEnvar("ACTION_INTERVAL").Short('i').Duration()
+	format             = kingpin.Flag("format", "Exposition format to negotiate with the targets (text, protobuf, openmetrics).").Default("text").Enum("text", "protobuf", "openmetrics")
+	scrapeTimeout      = kingpin.Flag("scrape-timeout", "Timeout of each scrape, failed scrapes are recorded as failure frames.").Default("10s").Duration()
+	umap               = kingpin.Flag("umap", "stringmap [eg. service.name=http://get.uri:port/uri].").Short('u').StringMap()
+	output             = kingpin.Flag("output", "Output file.").Short('o').OverrideDefaultFromEnvar("OUTPUT_FILE").Default("metrics").String()
 	maxIntervalsNumber = kingpin.Flag("maxIntervalsNumber", "Max number of intervals").Short('n').Default("120").Int()
-	Version    = "0.0.10"
-	filewriter io.WriteCloser
+	fileSD             = kingpin.Flag("file-sd", "Prometheus file_sd compatible JSON/YAML target files (glob patterns allowed), watched for changes.").Strings()
+	fileSDInterval     = kingpin.Flag("file-sd.refresh-interval", "Refresh interval to re-read the file_sd files, picking up the changes the watch missed.").Default("30s").Duration()
+	httpSD             = kingpin.Flag("http-sd", "Prometheus http_sd compatible endpoints to poll for targets.").Strings()
+	httpSDInterval     = kingpin.Flag("http-sd.refresh-interval", "Refresh interval to poll the http_sd endpoints.").Default("60s").Duration()
+	promSD             = kingpin.Flag("prometheus-sd", "Prometheus servers whose active targets (/api/v1/targets) should be recorded.").Strings()
+	promSDJob          = kingpin.Flag("prometheus-sd.job", "Regex the job of the Prometheus targets has to match.").Default(".*").String()
+	promSDInterval     = kingpin.Flag("prometheus-sd.refresh-interval", "Refresh interval to poll the Prometheus servers.").Default("60s").Duration()
+	Version            = "0.0.10"
+	filewriter         io.WriteCloser
 )
 
 func closeIfNotNil(wc io.WriteCloser) {
@@ -50,6 +62,64 @@ func writerFor() (io.Writer, error) {
 	return filewriter, nil
 }
 
+// acceptHeaders maps every --format to the Accept header sent to the
+// targets, the text format is always accepted as a fallback
+var acceptHeaders = map[string]string{
+	"text":        `text/plain;version=0.0.4;q=1,*/*;q=0.1`,
+	"protobuf":    `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3,*/*;q=0.1`,
+	"openmetrics": `application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1`,
+}
+
+// staticTargets converts the --umap services into discovery targets
+func staticTargets() []discovery.Target {
+	targets := make([]discovery.Target, 0, len(*umap))
+	for sname, url := range *umap {
+		targets = append(targets, discovery.Target{
+			Name: sname,
+			URL:  url,
+		})
+	}
+	return targets
+}
+
+// scrape fetches the target and returns the frame to be recorded: the dump
+// of the response or, whenever the scrape fails, a failure frame
+func scrape(client *http.Client, target discovery.Target) *model.Frame {
+	start := time.Now()
+	failure := func(kind string, err error) *model.Frame {
+		logrus.Errorf("scrape of %s failed with %v", target.URL, err)
+		return model.NewFailureFrame(target.Name, target.URL, &model.ScrapeFailure{
+			Kind:     kind,
+			Message:  err.Error(),
+			Duration: time.Since(start),
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	if err != nil {
+		return failure(model.FailureHTTP, err)
+	}
+	req.Header.Set("Accept", acceptHeaders[*format])
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return failure(model.FailureTimeout, err)
+		}
+		return failure(model.FailureHTTP, err)
+	}
+	defer resp.Body.Close()
+
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return failure(model.FailureDump, err)
+	}
+
+	frame := model.NewFrame(target.Name, target.URL, dump)
+	frame.Duration = time.Since(start)
+	return frame
+}
+
 func main() {
 	kingpin.Version(Version)
 	kingpin.Parse()
@@ -58,42 +128,46 @@ func main() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	if len(*umap) <= 0 {
+	if len(*umap) <= 0 && len(*fileSD) <= 0 && len(*httpSD) <= 0 && len(*promSD) <= 0 {
 		kingpin.Usage()
 		return
 	}
 
+	targetSet := discovery.NewSet()
+	if len(*fileSD) > 0 {
+		go targetSet.Run(context.Background(), discovery.NewFileProvider(*fileSD), *fileSDInterval)
+	}
+	for _, url := range *httpSD {
+		go targetSet.Run(context.Background(), discovery.NewHTTPProvider(url, *httpSDInterval), *httpSDInterval)
+	}
+	for _, url := range *promSD {
+		provider, err := discovery.NewPrometheusProvider(url, *promSDJob, *promSDInterval)
+		if err != nil {
+			logrus.Fatalf("invalid --prometheus-sd.job: %v", err)
+		}
+		go targetSet.Run(context.Background(), provider, *promSDInterval)
+	}
+
+	client := &http.Client{Timeout: *scrapeTimeout}
 	ticker := time.NewTicker(*interval)
 	intervalsCount := 0
 
 	for range ticker.C {
-		if (*maxIntervalsNumber > 0) {
-			if (intervalsCount > *maxIntervalsNumber) {
+		if *maxIntervalsNumber > 0 {
+			if intervalsCount > *maxIntervalsNumber {
 				os.Exit(0)
 			}
 		}
 
-		for sname, url := range *umap {
+		for _, target := range append(staticTargets(), targetSet.Targets()...) {
 			writer, err := writerFor()
 			if err != nil {
 				logrus.Errorf("writeFor failed with %v", err)
 				continue
 			}
 
-			resp, err := http.Get(url)
-			if err != nil {
-				logrus.Errorf("http.Get: %v", err)
-				continue
-			}
-			defer resp.Body.Close()
-
-			dump, err := httputil.DumpResponse(resp, true)
-			if err != nil {
-				logrus.Errorf("httputil.DumpResponse: %v", err)
-				continue
-			}
-
-			frame := model.NewFrame(sname, url, dump)
+			frame := scrape(client, target)
+			frame.Labels = target.Labels
 
 			err = model.WriteFrame(writer, frame)
 			if err != nil {
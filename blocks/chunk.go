@@ -0,0 +1,460 @@
+package blocks
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/tsdb/chunkenc"
+)
+
+// The chunk encodings of native histograms, numbered as Prometheus does:
+// integer counts are readable since Prometheus 2.40, float counts since 2.42
+const (
+	encHistogram      chunkenc.Encoding = 2
+	encFloatHistogram chunkenc.Encoding = 3
+)
+
+// The counter reset header, the first two bits of the third chunk byte
+const (
+	unknownCounterReset byte = 0x00
+	counterReset        byte = 0x80
+)
+
+// maxHistogramSamples is the number of samples after which a histogram chunk
+// is cut, as for the float chunks
+const maxHistogramSamples = 120
+
+// histogramChunk is a native histogram chunk in the format of Prometheus
+// tsdb/chunkenc: the number of samples (2 bytes), the counter reset header
+// (1 byte) and a bit stream starting with the layout (zero threshold, schema
+// and spans) shared by all the samples. The fields of a sample are written in
+// this order:
+//  - the timestamp: raw, then delta of delta
+//  - the count and the zero count: raw, then delta of delta for integer
+//    counts, xor for float ones
+//  - the sum: raw, then xor
+//  - the positive and negative buckets, as the counts
+// Integer bucket counts are delta encoded from one bucket to the next before
+// that, as in the exposition format.
+type histogramChunk struct {
+	b        bstream
+	encoding chunkenc.Encoding
+	layout   *playback.Histogram
+	previous *playback.Histogram
+
+	t, tDelta int64
+	sum       xorValue
+
+	// integer encoding
+	counts, deltas []int64
+	// float encoding
+	floats []xorValue
+}
+
+// newHistogramChunk generates a new chunk of the given encoding taking the
+// layout of the first histogram
+func newHistogramChunk(encoding chunkenc.Encoding, h *playback.Histogram, header byte) *histogramChunk {
+	c := &histogramChunk{
+		b:        bstream{stream: make([]byte, 3, 128)},
+		encoding: encoding,
+		layout:   h,
+		sum:      xorValue{leading: 0xff},
+	}
+	c.b.stream[2] = header
+	return c
+}
+
+// appendable tells whether the histogram can be appended to the chunk: same
+// layout, no counter reset, and room left
+func (c *histogramChunk) appendable(h *playback.Histogram) bool {
+	return c.NumSamples() < maxHistogramSamples && c.sameLayout(h) && !c.isCounterReset(h)
+}
+
+// sameLayout tells whether the histogram has the schema, zero threshold and
+// spans of the chunk
+func (c *histogramChunk) sameLayout(h *playback.Histogram) bool {
+	l := c.layout
+	return h.Schema == l.Schema && h.ZeroThreshold == l.ZeroThreshold &&
+		sameSpans(h.PositiveSpans, l.PositiveSpans) && sameSpans(h.NegativeSpans, l.NegativeSpans)
+}
+
+// append adds the histogram sample to the chunk, appendable has to be
+// checked before
+func (c *histogramChunk) append(t int64, h *playback.Histogram) {
+	num := binary.BigEndian.Uint16(c.b.bytes())
+	tDelta := int64(0)
+
+	if num == 0 {
+		putZeroThreshold(&c.b, h.ZeroThreshold)
+		putVarbitInt(&c.b, int64(h.Schema))
+		putSpans(&c.b, h.PositiveSpans)
+		putSpans(&c.b, h.NegativeSpans)
+		putVarbitInt(&c.b, t)
+	} else {
+		tDelta = t - c.t
+		putVarbitInt(&c.b, tDelta-c.tDelta)
+	}
+
+	if c.encoding == encHistogram {
+		c.appendCounts(num == 0, h)
+	} else {
+		c.appendFloats(num == 0, h)
+	}
+
+	binary.BigEndian.PutUint16(c.b.bytes(), num+1)
+	c.t, c.tDelta = t, tDelta
+	c.previous = h
+}
+
+// appendCounts writes the integer counts, raw for the first sample then delta
+// of delta
+func (c *histogramChunk) appendCounts(first bool, h *playback.Histogram) {
+	counts := []int64{int64(h.Count), int64(h.ZeroCount)}
+	counts = append(counts, bucketDeltas(h.PositiveBuckets)...)
+	counts = append(counts, bucketDeltas(h.NegativeBuckets)...)
+
+	if first {
+		c.deltas = make([]int64, len(counts))
+		putVarbitUint(&c.b, uint64(counts[0]))
+		putVarbitUint(&c.b, uint64(counts[1]))
+		c.b.writeBits(math.Float64bits(h.Sum), 64)
+		for _, count := range counts[2:] {
+			putVarbitInt(&c.b, count)
+		}
+		c.sum.value = h.Sum
+	} else {
+		c.writeCount(0, counts[0])
+		c.writeCount(1, counts[1])
+		c.writeXor(&c.sum, h.Sum)
+		for i := 2; i < len(counts); i++ {
+			c.writeCount(i, counts[i])
+		}
+	}
+	c.counts = counts
+}
+
+// appendFloats writes the float counts, raw for the first sample then xor
+func (c *histogramChunk) appendFloats(first bool, h *playback.Histogram) {
+	values := []float64{h.Count, h.ZeroCount}
+	values = append(values, h.PositiveBuckets...)
+	values = append(values, h.NegativeBuckets...)
+
+	if first {
+		c.floats = make([]xorValue, len(values))
+		for i, v := range values {
+			c.floats[i] = xorValue{value: v, leading: 0xff}
+		}
+		c.b.writeBits(math.Float64bits(values[0]), 64)
+		c.b.writeBits(math.Float64bits(values[1]), 64)
+		c.b.writeBits(math.Float64bits(h.Sum), 64)
+		for _, v := range values[2:] {
+			c.b.writeBits(math.Float64bits(v), 64)
+		}
+		c.sum.value = h.Sum
+		return
+	}
+
+	c.writeXor(&c.floats[0], values[0])
+	c.writeXor(&c.floats[1], values[1])
+	c.writeXor(&c.sum, h.Sum)
+	for i := 2; i < len(values); i++ {
+		c.writeXor(&c.floats[i], values[i])
+	}
+}
+
+// writeCount writes the delta of delta of the i-th integer count
+func (c *histogramChunk) writeCount(i int, count int64) {
+	delta := count - c.counts[i]
+	putVarbitInt(&c.b, delta-c.deltas[i])
+	c.deltas[i] = delta
+}
+
+func (c *histogramChunk) writeXor(old *xorValue, v float64) {
+	xorWrite(&c.b, v, old.value, &old.leading, &old.trailing)
+	old.value = v
+}
+
+// Bytes returns the encoded chunk
+func (c *histogramChunk) Bytes() []byte {
+	return c.b.bytes()
+}
+
+// Encoding returns the integer or float histogram encoding
+func (c *histogramChunk) Encoding() chunkenc.Encoding {
+	return c.encoding
+}
+
+// NumSamples returns the number of histograms in the chunk
+func (c *histogramChunk) NumSamples() int {
+	return int(binary.BigEndian.Uint16(c.b.bytes()))
+}
+
+// Appender is not supported, histograms are appended with append
+func (c *histogramChunk) Appender() (chunkenc.Appender, error) {
+	return nil, errors.New("histogram chunks do not take float samples")
+}
+
+// Iterator is not supported, the chunk is only written
+func (c *histogramChunk) Iterator(chunkenc.Iterator) chunkenc.Iterator {
+	return errIterator{errors.New("histogram chunks cannot be read as float samples")}
+}
+
+type errIterator struct {
+	err error
+}
+
+func (it errIterator) At() (int64, float64) { return 0, 0 }
+func (it errIterator) Err() error           { return it.err }
+func (it errIterator) Next() bool           { return false }
+
+// isIntegral tells whether all the counts of the histogram are integers, so
+// that the integer encoding can be used
+func isIntegral(h *playback.Histogram) bool {
+	if !isCount(h.Count) || !isCount(h.ZeroCount) {
+		return false
+	}
+	for _, buckets := range [][]float64{h.PositiveBuckets, h.NegativeBuckets} {
+		for _, b := range buckets {
+			if !isCount(b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isCount(f float64) bool {
+	return f >= 0 && f == math.Trunc(f) && f < 1<<53
+}
+
+// isCounterReset tells whether the histogram follows a counter reset: the
+// count went down or, the layout being the same, any bucket did
+func (c *histogramChunk) isCounterReset(h *playback.Histogram) bool {
+	previous := c.previous
+	if h.Count < previous.Count {
+		return true
+	}
+	if !c.sameLayout(h) {
+		return false
+	}
+	if h.ZeroCount < previous.ZeroCount {
+		return true
+	}
+	for i, b := range h.PositiveBuckets {
+		if b < previous.PositiveBuckets[i] {
+			return true
+		}
+	}
+	for i, b := range h.NegativeBuckets {
+		if b < previous.NegativeBuckets[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSpans(a, b []playback.Span) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bucketDeltas delta encodes the integer bucket counts
+func bucketDeltas(counts []float64) []int64 {
+	deltas := make([]int64, 0, len(counts))
+	previous := int64(0)
+	for _, c := range counts {
+		deltas = append(deltas, int64(c)-previous)
+		previous = int64(c)
+	}
+	return deltas
+}
+
+func putSpans(b *bstream, spans []playback.Span) {
+	putVarbitUint(b, uint64(len(spans)))
+	for _, s := range spans {
+		putVarbitUint(b, uint64(s.Length))
+		putVarbitInt(b, int64(s.Offset))
+	}
+}
+
+// putZeroThreshold writes 0 as a zero byte, the powers of 2 between 2^-243
+// and 2^10 as a byte holding their exponent, any other threshold as 255
+// followed by the float
+func putZeroThreshold(b *bstream, threshold float64) {
+	if threshold == 0 {
+		b.writeByte(0)
+		return
+	}
+	frac, exp := math.Frexp(threshold)
+	if frac != 0.5 || exp < -242 || exp > 11 {
+		b.writeByte(255)
+		b.writeBits(math.Float64bits(threshold), 64)
+		return
+	}
+	b.writeByte(byte(exp + 243))
+}
+
+// putVarbitInt writes the integer prefixed by the number of bits it takes,
+// 0 taking a single bit
+func putVarbitInt(b *bstream, val int64) {
+	switch {
+	case val == 0:
+		b.writeBit(false)
+	case bitRange(val, 3):
+		b.writeBits(0x02, 2)
+		b.writeBits(uint64(val), 3)
+	case bitRange(val, 6):
+		b.writeBits(0x06, 3)
+		b.writeBits(uint64(val), 6)
+	case bitRange(val, 9):
+		b.writeBits(0x0e, 4)
+		b.writeBits(uint64(val), 9)
+	case bitRange(val, 12):
+		b.writeBits(0x1e, 5)
+		b.writeBits(uint64(val), 12)
+	case bitRange(val, 18):
+		b.writeBits(0x3e, 6)
+		b.writeBits(uint64(val), 18)
+	case bitRange(val, 25):
+		b.writeBits(0x7e, 7)
+		b.writeBits(uint64(val), 25)
+	case bitRange(val, 56):
+		b.writeBits(0xfe, 8)
+		b.writeBits(uint64(val), 56)
+	default:
+		b.writeBits(0xff, 8)
+		b.writeBits(uint64(val), 64)
+	}
+}
+
+// putVarbitUint writes the unsigned integer with the prefixes of
+// putVarbitInt
+func putVarbitUint(b *bstream, val uint64) {
+	switch {
+	case val == 0:
+		b.writeBit(false)
+	case bits.LeadingZeros64(val) >= 64-3:
+		b.writeBits(0x02, 2)
+		b.writeBits(val, 3)
+	case bits.LeadingZeros64(val) >= 64-6:
+		b.writeBits(0x06, 3)
+		b.writeBits(val, 6)
+	case bits.LeadingZeros64(val) >= 64-9:
+		b.writeBits(0x0e, 4)
+		b.writeBits(val, 9)
+	case bits.LeadingZeros64(val) >= 64-12:
+		b.writeBits(0x1e, 5)
+		b.writeBits(val, 12)
+	case bits.LeadingZeros64(val) >= 64-18:
+		b.writeBits(0x3e, 6)
+		b.writeBits(val, 18)
+	case bits.LeadingZeros64(val) >= 64-25:
+		b.writeBits(0x7e, 7)
+		b.writeBits(val, 25)
+	case bits.LeadingZeros64(val) >= 64-56:
+		b.writeBits(0xfe, 8)
+		b.writeBits(val, 56)
+	default:
+		b.writeBits(0xff, 8)
+		b.writeBits(val, 64)
+	}
+}
+
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// xorValue is a float written as the xor with the previous value, along with
+// the leading and trailing zeros of the last xor written
+type xorValue struct {
+	value    float64
+	leading  uint8
+	trailing uint8
+}
+
+// xorWrite writes the xor of the values as the float chunks do, reusing the
+// previous leading and trailing zeros when the xor fits in them
+func xorWrite(b *bstream, newValue, currentValue float64, leading, trailing *uint8) {
+	delta := math.Float64bits(newValue) ^ math.Float64bits(currentValue)
+	if delta == 0 {
+		b.writeBit(false)
+		return
+	}
+	b.writeBit(true)
+
+	newLeading := uint8(bits.LeadingZeros64(delta))
+	newTrailing := uint8(bits.TrailingZeros64(delta))
+	if newLeading >= 32 {
+		newLeading = 31
+	}
+
+	if *leading != 0xff && newLeading >= *leading && newTrailing >= *trailing {
+		b.writeBit(false)
+		b.writeBits(delta>>*trailing, 64-int(*leading)-int(*trailing))
+		return
+	}
+
+	*leading, *trailing = newLeading, newTrailing
+	b.writeBit(true)
+	b.writeBits(uint64(newLeading), 5)
+	// 64 significant bits are written as 0, they never are 0
+	sigbits := 64 - newLeading - newTrailing
+	b.writeBits(uint64(sigbits), 6)
+	b.writeBits(delta>>newTrailing, int(sigbits))
+}
+
+// bstream is a stream of bits, count is the number of bits left in the last
+// byte
+type bstream struct {
+	stream []byte
+	count  uint8
+}
+
+func (b *bstream) bytes() []byte {
+	return b.stream
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.count - 1)
+	}
+	b.count--
+}
+
+func (b *bstream) writeByte(byt byte) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+	b.stream[len(b.stream)-1] |= byt >> (8 - b.count)
+	b.stream = append(b.stream, byt<<b.count)
+}
+
+// writeBits writes the nbits right-most bits of u, left to right
+func (b *bstream) writeBits(u uint64, nbits int) {
+	u <<= 64 - uint(nbits)
+	for nbits >= 8 {
+		b.writeByte(byte(u >> 56))
+		u <<= 8
+		nbits -= 8
+	}
+	for nbits > 0 {
+		b.writeBit((u >> 63) == 1)
+		u <<= 1
+		nbits--
+	}
+}
@@ -0,0 +1,63 @@
+package blocks
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/stretchr/testify/assert"
+)
+
+// the expected chunks were encoded by Prometheus tsdb/chunkenc
+func TestHistogramChunkIntegerCounts(t *testing.T) {
+	positive := []playback.Span{{Offset: 0, Length: 2}, {Offset: 3, Length: 1}}
+	negative := []playback.Span{{Offset: -1, Length: 1}}
+	histograms := []*playback.Histogram{
+		{Schema: 1, ZeroThreshold: 0.001, ZeroCount: 1, Count: 8, Sum: 12.5, PositiveSpans: positive, PositiveBuckets: []float64{1, 3, 2}, NegativeSpans: negative, NegativeBuckets: []float64{1}},
+		{Schema: 1, ZeroThreshold: 0.001, ZeroCount: 3, Count: 13, Sum: 20.25, PositiveSpans: positive, PositiveBuckets: []float64{2, 5, 2}, NegativeSpans: negative, NegativeBuckets: []float64{1}},
+		{Schema: 1, ZeroThreshold: 0.001, ZeroCount: 3, Count: 21, Sum: 33, PositiveSpans: positive, PositiveBuckets: []float64{4, 9, 3}, NegativeSpans: negative, NegativeBuckets: []float64{2}},
+	}
+
+	c := newHistogramChunk(encHistogram, histograms[0], unknownCounterReset)
+	for i, h := range histograms {
+		assert.True(t, i == 0 || c.appendable(h), "growing histograms should be appendable")
+		c.append(int64(1000+15000*i+i*i), h)
+	}
+
+	assert.Equal(t, 3, c.NumSamples(), "all the histograms should be appended")
+	assert.Equal(t, "000300ff3f50624dd2f1a9fc8ca48ce31bf8fa311140290000000000008caf1f83a99c2cb58fd631b253b6927a718de2",
+		hex.EncodeToString(c.Bytes()), "the chunk should be encoded as Prometheus does")
+}
+
+func TestHistogramChunkFloatCounts(t *testing.T) {
+	spans := []playback.Span{{Offset: 1, Length: 2}}
+	histograms := []*playback.Histogram{
+		{Schema: 0, ZeroThreshold: 0.125, ZeroCount: 0.5, Count: 2, Sum: 3.5, PositiveSpans: spans, PositiveBuckets: []float64{0.5, 1}},
+		{Schema: 0, ZeroThreshold: 0.125, ZeroCount: 0.5, Count: 3.5, Sum: 7, PositiveSpans: spans, PositiveBuckets: []float64{1.5, 1.5}},
+		{Schema: 0, ZeroThreshold: 0.125, ZeroCount: 1.25, Count: 4.25, Sum: 7.75, PositiveSpans: spans, PositiveBuckets: []float64{1.5, 1.5}},
+	}
+
+	c := newHistogramChunk(encFloatHistogram, histograms[0], unknownCounterReset)
+	for i, h := range histograms {
+		c.append(int64(1000+15000*i), h)
+	}
+
+	assert.Equal(t, "000300f1465178fa10000000000000000ff800000000000010030000000000000ff80000000000000ffc0000000000003e0ea63605b583d617b01b58bdd61ddc1600",
+		hex.EncodeToString(c.Bytes()), "the chunk should be encoded as Prometheus does")
+}
+
+func TestHistogramChunkAppendable(t *testing.T) {
+	spans := []playback.Span{{Offset: 0, Length: 2}}
+	h := &playback.Histogram{Schema: 0, Count: 3, PositiveSpans: spans, PositiveBuckets: []float64{1, 2}}
+	c := newHistogramChunk(encHistogram, h, unknownCounterReset)
+	c.append(1000, h)
+
+	assert.False(t, c.appendable(&playback.Histogram{Schema: 0, Count: 4, PositiveSpans: spans, PositiveBuckets: []float64{0, 4}}),
+		"a bucket going down should be a counter reset")
+	assert.True(t, c.isCounterReset(&playback.Histogram{Schema: 1, Count: 2, PositiveSpans: spans, PositiveBuckets: []float64{1, 1}}),
+		"the count going down should be a counter reset, whatever the layout")
+	assert.False(t, c.appendable(&playback.Histogram{Schema: 1, Count: 4, PositiveSpans: spans, PositiveBuckets: []float64{2, 2}}),
+		"a new schema should cut a new chunk")
+	assert.False(t, c.isCounterReset(&playback.Histogram{Schema: 1, Count: 4, PositiveSpans: spans, PositiveBuckets: []float64{0, 4}}),
+		"the buckets of different layouts should not be compared")
+}
@@ -0,0 +1,188 @@
+package blocks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/index"
+	"github.com/prometheus/tsdb/labels"
+)
+
+// histogramSeries buffers the native histograms of a series in a block range
+type histogramSeries struct {
+	labels     labels.Labels
+	samples    []histogramSample
+	timestamps map[int64]bool
+}
+
+type histogramSample struct {
+	t int64
+	h *playback.Histogram
+}
+
+// chunks encodes the samples sorted by time, with integer counts unless any
+// histogram has float counts. A chunk is cut when the layout changes, on
+// counter resets and every maxHistogramSamples.
+func (s *histogramSeries) chunks() []chunks.Meta {
+	sort.Slice(s.samples, func(i, j int) bool { return s.samples[i].t < s.samples[j].t })
+
+	encoding := encHistogram
+	for _, sample := range s.samples {
+		if !isIntegral(sample.h) {
+			encoding = encFloatHistogram
+		}
+	}
+
+	var metas []chunks.Meta
+	var chunk *histogramChunk
+	for _, sample := range s.samples {
+		if chunk == nil || !chunk.appendable(sample.h) {
+			header := unknownCounterReset
+			if chunk != nil && chunk.isCounterReset(sample.h) {
+				header = counterReset
+			}
+			chunk = newHistogramChunk(encoding, sample.h, header)
+			metas = append(metas, chunks.Meta{Chunk: chunk, MinTime: sample.t})
+		}
+		chunk.append(sample.t, sample.h)
+		metas[len(metas)-1].MaxTime = sample.t
+	}
+	return metas
+}
+
+// validHistogram tells whether the spans of the histogram lay out as many
+// buckets as it has
+func validHistogram(h *playback.Histogram) bool {
+	count := func(spans []playback.Span) int {
+		n := 0
+		for _, s := range spans {
+			n += int(s.Length)
+		}
+		return n
+	}
+	return count(h.PositiveSpans) == len(h.PositiveBuckets) && count(h.NegativeSpans) == len(h.NegativeBuckets)
+}
+
+// writeHistogramBlock writes the series as a block under dir, the way the
+// compactor writes the heads: chunks, index and meta.json into a temporary
+// directory renamed once complete. The block has no tombstones file, a
+// missing one is read as empty.
+func writeHistogramBlock(dir string, series []*histogramSeries) (id ulid.ULID, err error) {
+	sort.Slice(series, func(i, j int) bool { return labels.Compare(series[i].labels, series[j].labels) < 0 })
+
+	id = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	tmp := filepath.Join(dir, id.String()+".tmp")
+	var chunkw *chunks.Writer
+	var indexw *index.Writer
+	defer func() {
+		if err == nil {
+			return
+		}
+		if chunkw != nil {
+			chunkw.Close()
+		}
+		if indexw != nil {
+			indexw.Close()
+		}
+		os.RemoveAll(tmp)
+	}()
+	if err = os.MkdirAll(tmp, 0777); err != nil {
+		return id, err
+	}
+
+	if chunkw, err = chunks.NewWriter(filepath.Join(tmp, "chunks")); err != nil {
+		return id, err
+	}
+	if indexw, err = index.NewWriter(filepath.Join(tmp, "index")); err != nil {
+		return id, err
+	}
+
+	symbols := make(map[string]struct{})
+	values := make(map[string]map[string]struct{})
+	for _, s := range series {
+		for _, l := range s.labels {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+			if values[l.Name] == nil {
+				values[l.Name] = make(map[string]struct{})
+			}
+			values[l.Name][l.Value] = struct{}{}
+		}
+	}
+	if err = indexw.AddSymbols(symbols); err != nil {
+		return id, err
+	}
+
+	meta := &tsdb.BlockMeta{
+		ULID:       id,
+		Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{id}},
+		Version:    1,
+	}
+	postings := index.NewMemPostings()
+	for i, s := range series {
+		metas := s.chunks()
+		if err = chunkw.WriteChunks(metas...); err != nil {
+			return id, err
+		}
+		if err = indexw.AddSeries(uint64(i), s.labels, metas...); err != nil {
+			return id, err
+		}
+		postings.Add(uint64(i), s.labels)
+
+		if i == 0 || metas[0].MinTime < meta.MinTime {
+			meta.MinTime = metas[0].MinTime
+		}
+		if i == 0 || metas[len(metas)-1].MaxTime+1 > meta.MaxTime {
+			meta.MaxTime = metas[len(metas)-1].MaxTime + 1
+		}
+		meta.Stats.NumSeries++
+		meta.Stats.NumChunks += uint64(len(metas))
+		meta.Stats.NumSamples += uint64(len(s.samples))
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vs := make([]string, 0, len(values[name]))
+		for v := range values[name] {
+			vs = append(vs, v)
+		}
+		if err = indexw.WriteLabelIndex([]string{name}, vs); err != nil {
+			return id, err
+		}
+	}
+	for _, l := range postings.SortedKeys() {
+		if err = indexw.WritePostings(l.Name, l.Value, postings.Get(l.Name, l.Value)); err != nil {
+			return id, err
+		}
+	}
+
+	if err = chunkw.Close(); err != nil {
+		return id, err
+	}
+	if err = indexw.Close(); err != nil {
+		return id, err
+	}
+
+	content, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return id, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(tmp, "meta.json"), content, 0666); err != nil {
+		return id, err
+	}
+	err = os.Rename(tmp, filepath.Join(dir, id.String()))
+	return id, err
+}
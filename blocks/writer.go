@@ -0,0 +1,254 @@
+package blocks
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/tsdb/labels"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultBlockDuration is the range of the blocks Prometheus cuts from its
+// head, blocks of this size are compacted into larger ones by Prometheus
+const DefaultBlockDuration = 2 * time.Hour
+
+// Writer writes samples into Prometheus 2.x TSDB blocks. Samples are buffered
+// in an in-memory head for every block range, aligned to the block duration
+// as Prometheus does. A head is written as a block once the input moved more
+// than a block duration past its range, and on Close. Native histograms are
+// buffered alongside and written as a block of histogram chunks of the same
+// range, which Prometheus 2.40 or later reads.
+type Writer struct {
+	dir           string
+	blockDuration int64
+	compactor     *tsdb.LeveledCompactor
+	heads         map[int64]*tsdb.Head
+	histograms    map[int64]map[string]*histogramSeries
+	written       map[int64]bool
+	maxTime       int64
+}
+
+// NewWriter generates a new Writer creating the blocks under dir
+func NewWriter(dir string, blockDuration time.Duration) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	duration := int64(blockDuration / time.Millisecond)
+	compactor, err := tsdb.NewLeveledCompactor(context.Background(), nil, log.NewNopLogger(), []int64{duration}, chunkenc.NewPool())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		dir:           dir,
+		blockDuration: duration,
+		compactor:     compactor,
+		heads:         make(map[int64]*tsdb.Head),
+		histograms:    make(map[int64]map[string]*histogramSeries),
+		written:       make(map[int64]bool),
+	}, nil
+}
+
+// Append buffers the samples into the heads of their block ranges and writes
+// the heads the input moved past. It returns the number of samples discarded
+// (eg. out of order or duplicated ones).
+func (w *Writer) Append(samples model.Vector) (int, error) {
+	discarded := 0
+	appenders := make(map[int64]tsdb.Appender)
+	for _, s := range samples {
+		t := int64(s.Timestamp)
+		start := rangeStart(t, w.blockDuration)
+
+		app, ok := appenders[start]
+		if !ok {
+			head, err := w.head(start)
+			if err != nil {
+				return discarded, err
+			}
+			app = head.Appender()
+			appenders[start] = app
+		}
+
+		if _, err := app.Add(metricLabels(s.Metric), t, float64(s.Value)); err != nil {
+			discarded++
+			logrus.WithFields(logrus.Fields{
+				"sample": s,
+				"error":  err,
+			}).Error("Sample discarded")
+			continue
+		}
+		if t > w.maxTime {
+			w.maxTime = t
+		}
+	}
+
+	for _, app := range appenders {
+		if err := app.Commit(); err != nil {
+			return discarded, err
+		}
+	}
+	return discarded, w.flush(false)
+}
+
+// AppendHistograms buffers the native histograms into their block ranges and
+// writes the ranges the input moved past. It returns the number of histograms
+// discarded (eg. duplicated ones).
+func (w *Writer) AppendHistograms(histograms []*playback.HistogramSample) (int, error) {
+	discarded := 0
+	for _, h := range histograms {
+		t := int64(h.Timestamp)
+		var series *histogramSeries
+		if validHistogram(h.Histogram) {
+			series = w.histogramSeries(rangeStart(t, w.blockDuration), metricLabels(h.Metric))
+		}
+
+		if series == nil || series.timestamps[t] {
+			discarded++
+			logrus.WithFields(logrus.Fields{
+				"metric":    h.Metric,
+				"timestamp": h.Timestamp,
+			}).Error("Histogram discarded")
+			continue
+		}
+		series.timestamps[t] = true
+		series.samples = append(series.samples, histogramSample{t: t, h: h.Histogram})
+		if t > w.maxTime {
+			w.maxTime = t
+		}
+	}
+	return discarded, w.flush(false)
+}
+
+// Flush writes all the pending heads and histograms as blocks. Samples
+// appended later to the same block ranges end up in overlapping blocks.
+func (w *Writer) Flush() error {
+	return w.flush(true)
+}
+
+// Close writes all the pending heads and histograms as blocks
+func (w *Writer) Close() error {
+	return w.flush(true)
+}
+
+// head returns the head of the block range starting at start, creating it if
+// needed
+func (w *Writer) head(start int64) (*tsdb.Head, error) {
+	if head, ok := w.heads[start]; ok {
+		return head, nil
+	}
+	w.checkWritten(start)
+
+	// the chunk range is twice the block duration so that the head accepts
+	// any sample of its block range, whatever the order
+	head, err := tsdb.NewHead(nil, log.NewNopLogger(), nil, 2*w.blockDuration)
+	if err != nil {
+		return nil, err
+	}
+	w.heads[start] = head
+	return head, nil
+}
+
+// histogramSeries returns the histogram series of the block range starting
+// at start, creating it if needed
+func (w *Writer) histogramSeries(start int64, lset labels.Labels) *histogramSeries {
+	ranged, ok := w.histograms[start]
+	if !ok {
+		w.checkWritten(start)
+		ranged = make(map[string]*histogramSeries)
+		w.histograms[start] = ranged
+	}
+
+	key := lset.String()
+	series, ok := ranged[key]
+	if !ok {
+		series = &histogramSeries{labels: lset, timestamps: make(map[int64]bool)}
+		ranged[key] = series
+	}
+	return series
+}
+
+// checkWritten warns when data is buffered for a block range already written
+func (w *Writer) checkWritten(start int64) {
+	if w.written[start] {
+		logrus.Warnf("Samples older than %v found after its block was written, the block range will have overlapping blocks",
+			model.Time(start).Time().UTC())
+	}
+}
+
+// flush writes the heads and the histograms the input moved past, or all of
+// them
+func (w *Writer) flush(all bool) error {
+	pending := make(map[int64]bool)
+	for start := range w.heads {
+		pending[start] = true
+	}
+	for start := range w.histograms {
+		pending[start] = true
+	}
+	starts := make([]int64, 0, len(pending))
+	for start := range pending {
+		if all || start+2*w.blockDuration <= w.maxTime {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	for _, start := range starts {
+		if head, ok := w.heads[start]; ok {
+			if head.NumSeries() > 0 {
+				id, err := w.compactor.Write(w.dir, head, head.MinTime(), head.MaxTime()+1, nil)
+				if err != nil {
+					return err
+				}
+				logrus.Infof("Block %v written for %v", id, model.Time(start).Time().UTC())
+			}
+			if err := head.Close(); err != nil {
+				return err
+			}
+			delete(w.heads, start)
+		}
+
+		if ranged, ok := w.histograms[start]; ok {
+			series := make([]*histogramSeries, 0, len(ranged))
+			for _, s := range ranged {
+				series = append(series, s)
+			}
+			id, err := writeHistogramBlock(w.dir, series)
+			if err != nil {
+				return err
+			}
+			logrus.Infof("Histogram block %v written for %v", id, model.Time(start).Time().UTC())
+			delete(w.histograms, start)
+		}
+		w.written[start] = true
+	}
+	return nil
+}
+
+// rangeStart returns the start of the block range holding t, flooring the
+// division so that negative timestamps are aligned as well
+func rangeStart(t, width int64) int64 {
+	start := t - t%width
+	if t < 0 && start != t {
+		start -= width
+	}
+	return start
+}
+
+// metricLabels converts the metric into sorted TSDB labels
+func metricLabels(metric model.Metric) labels.Labels {
+	lset := make(labels.Labels, 0, len(metric))
+	for name, value := range metric {
+		lset = append(lset, labels.Label{Name: string(name), Value: string(value)})
+	}
+	sort.Sort(lset)
+	return lset
+}
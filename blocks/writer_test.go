@@ -0,0 +1,153 @@
+package blocks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+var hour = int64(time.Hour / time.Millisecond)
+
+func sample(name string, t int64, v float64) *model.Sample {
+	return &model.Sample{
+		Metric:    model.Metric{model.MetricNameLabel: model.LabelValue(name), "job": "app"},
+		Timestamp: model.Time(t),
+		Value:     model.SampleValue(v),
+	}
+}
+
+func openBlocks(t *testing.T, dir string) []*tsdb.Block {
+	dirs, err := filepath.Glob(filepath.Join(dir, "*", "meta.json"))
+	assert.Empty(t, err, "should not be any error")
+
+	blocks := make([]*tsdb.Block, 0, len(dirs))
+	for _, meta := range dirs {
+		block, err := tsdb.OpenBlock(nil, filepath.Dir(meta), nil)
+		assert.Empty(t, err, "blocks should be readable")
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestWriterBlockRanges(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "blocks")
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, DefaultBlockDuration)
+	assert.Empty(t, err, "should not be any error")
+
+	discarded, err := w.Append(model.Vector{
+		sample("up", 100*hour, 1),
+		sample("up", 101*hour, 1),
+		sample("up", 102*hour, 0),
+	})
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 0, discarded, "no sample should be discarded")
+	assert.Equal(t, 0, len(openBlocks(t, dir)), "no block should be written before the input moves past it")
+
+	w.Append(model.Vector{sample("up", 104*hour, 1)})
+	assert.Equal(t, 1, len(openBlocks(t, dir)), "the blocks the input moved past should be written")
+
+	assert.Empty(t, w.Close(), "should not be any error")
+	blocks := openBlocks(t, dir)
+	assert.Equal(t, 3, len(blocks), "there should be a block for every 2h range")
+	for _, block := range blocks {
+		meta := block.Meta()
+		start := meta.MinTime - meta.MinTime%(2*hour)
+		assert.True(t, meta.MaxTime <= start+2*hour, "blocks should not cross the 2h ranges")
+		block.Close()
+	}
+}
+
+func TestRangeStart(t *testing.T) {
+	assert.Equal(t, 100*hour, rangeStart(101*hour, 2*hour), "timestamps should be aligned to the range start")
+	assert.Equal(t, 100*hour, rangeStart(100*hour, 2*hour), "the range start should be included")
+	assert.Equal(t, -2*hour, rangeStart(-hour, 2*hour), "negative timestamps should be aligned to the range before them")
+	assert.Equal(t, -2*hour, rangeStart(-2*hour, 2*hour), "negative range starts should be included")
+}
+
+func TestWriterSamples(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "blocks")
+	defer os.RemoveAll(dir)
+
+	w, _ := NewWriter(dir, DefaultBlockDuration)
+	w.Append(model.Vector{sample("temperature", 1000, 21.5), sample("temperature", 2000, 22)})
+	discarded, _ := w.Append(model.Vector{sample("temperature", 1500, 1)})
+	assert.Equal(t, 1, discarded, "out of order samples should be discarded")
+	assert.Empty(t, w.Close(), "should not be any error")
+
+	blocks := openBlocks(t, dir)
+	assert.Equal(t, 1, len(blocks), "there should be exactly 1 block")
+	defer blocks[0].Close()
+
+	q, err := tsdb.NewBlockQuerier(blocks[0], 0, 3000)
+	assert.Empty(t, err, "should not be any error")
+	defer q.Close()
+
+	set, err := q.Select(labels.NewEqualMatcher("__name__", "temperature"))
+	assert.Empty(t, err, "should not be any error")
+	assert.True(t, set.Next(), "the series should be written")
+	assert.Equal(t, "app", set.At().Labels().Get("job"), "labels should be written")
+
+	values := []float64{}
+	it := set.At().Iterator()
+	for it.Next() {
+		_, v := it.At()
+		values = append(values, v)
+	}
+	assert.Equal(t, []float64{21.5, 22}, values, "samples should be written")
+}
+
+func TestWriterHistograms(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "blocks")
+	defer os.RemoveAll(dir)
+
+	metric := model.Metric{model.MetricNameLabel: "latency", "job": "app"}
+	histogram := func(count float64) *playback.Histogram {
+		return &playback.Histogram{Count: count, PositiveSpans: []playback.Span{{Length: 1}}, PositiveBuckets: []float64{count}}
+	}
+
+	w, _ := NewWriter(dir, DefaultBlockDuration)
+	discarded, err := w.AppendHistograms([]*playback.HistogramSample{
+		{Metric: metric, Histogram: histogram(1), Timestamp: 2000},
+		{Metric: metric, Histogram: histogram(2), Timestamp: 1000},
+		{Metric: metric, Histogram: histogram(3), Timestamp: 2000},
+		{Metric: metric, Histogram: &playback.Histogram{Count: 1, PositiveSpans: []playback.Span{{Length: 2}}}, Timestamp: 3000},
+		{Metric: model.Metric{model.MetricNameLabel: "invalid"}, Histogram: &playback.Histogram{PositiveBuckets: []float64{1}}, Timestamp: 3000},
+	})
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 3, discarded, "duplicated histograms and histograms not matching their spans should be discarded")
+	assert.Empty(t, w.Close(), "should not be any error")
+
+	blocks := openBlocks(t, dir)
+	assert.Equal(t, 1, len(blocks), "there should be exactly 1 block")
+	defer blocks[0].Close()
+
+	meta := blocks[0].Meta()
+	assert.Equal(t, int64(1000), meta.MinTime, "the block should start at the first histogram")
+	assert.Equal(t, int64(2001), meta.MaxTime, "the block should end after the last histogram")
+	assert.Equal(t, uint64(2), meta.Stats.NumSamples, "histograms should be written")
+	assert.Equal(t, uint64(2), meta.Stats.NumChunks, "a counter reset should cut a new chunk")
+
+	ir, err := blocks[0].Index()
+	assert.Empty(t, err, "should not be any error")
+	defer ir.Close()
+	p, err := ir.Postings(model.MetricNameLabel, "latency")
+	assert.Empty(t, err, "should not be any error")
+	assert.True(t, p.Next(), "the series should be indexed")
+
+	var lset labels.Labels
+	var chks []chunks.Meta
+	assert.Empty(t, ir.Series(p.At(), &lset, &chks), "should not be any error")
+	assert.Equal(t, "app", lset.Get("job"), "labels should be written")
+	assert.Equal(t, int64(1000), chks[0].MinTime, "histograms should be sorted by time")
+}
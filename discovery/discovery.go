@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Target represents a service that has to be scraped
+//  - a Name that represents the service (used as job by promplay)
+//  - an URL that represents the service location
+//  - the Labels that have to be attached to every recorded frame
+type Target struct {
+	Name   string
+	URL    string
+	Labels map[string]string
+}
+
+// Provider is a source of targets
+type Provider interface {
+	// Name identifies the provider inside a Set
+	Name() string
+	// Refresh returns the complete list of targets currently known
+	Refresh() ([]Target, error)
+}
+
+// Watcher is implemented by the providers able to tell when their targets
+// may have changed, so that they are refreshed right away instead of at the
+// next interval
+type Watcher interface {
+	// Watch sends on the returned channel whenever the targets may have
+	// changed, until the context is done. A nil channel means that the
+	// changes cannot be watched.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// Set keeps track of the latest targets returned by every Provider
+type Set struct {
+	mutex   sync.RWMutex
+	targets map[string][]Target
+}
+
+// NewSet generates a new empty Set
+func NewSet() *Set {
+	return &Set{
+		targets: make(map[string][]Target),
+	}
+}
+
+// Run refreshes the provider targets every interval until the context is
+// done, and as soon as they change for the providers that are a Watcher.
+// Whenever a refresh fails the previous targets are kept.
+func (s *Set) Run(ctx context.Context, provider Provider, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var changes <-chan struct{}
+	if watcher, ok := provider.(Watcher); ok {
+		changes = watcher.Watch(ctx)
+	}
+
+	for {
+		s.refresh(provider)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case _, ok := <-changes:
+			if !ok {
+				changes = nil
+			}
+		}
+	}
+}
+
+func (s *Set) refresh(provider Provider) {
+	targets, err := provider.Refresh()
+	if err != nil {
+		logrus.Errorf("%s refresh failed with %v", provider.Name(), err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(targets) != len(s.targets[provider.Name()]) {
+		logrus.Infof("%s discovered %d targets", provider.Name(), len(targets))
+	}
+	s.targets[provider.Name()] = targets
+}
+
+// Targets returns the targets of all the providers sorted by Name and URL
+func (s *Set) Targets() []Target {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	out := make([]Target, 0)
+	for _, targets := range s.targets {
+		out = append(out, targets...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].URL < out[j].URL
+	})
+	return out
+}
@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticProvider struct {
+	name    string
+	targets []Target
+	err     error
+}
+
+func (sp *staticProvider) Name() string {
+	return sp.name
+}
+
+func (sp *staticProvider) Refresh() ([]Target, error) {
+	return sp.targets, sp.err
+}
+
+func TestSetTargets(t *testing.T) {
+	set := NewSet()
+	set.refresh(&staticProvider{name: "b", targets: []Target{{Name: "b", URL: "http://b"}}})
+	set.refresh(&staticProvider{name: "a", targets: []Target{{Name: "a", URL: "http://a2"}, {Name: "a", URL: "http://a1"}}})
+
+	targets := set.Targets()
+	assert.Equal(t, 3, len(targets), "there should be exactly 3 targets")
+	assert.Equal(t, "http://a1", targets[0].URL, "targets should be sorted")
+	assert.Equal(t, "http://a2", targets[1].URL, "targets should be sorted")
+	assert.Equal(t, "http://b", targets[2].URL, "targets should be sorted")
+}
+
+func TestSetKeepsTargetsOnError(t *testing.T) {
+	set := NewSet()
+	provider := &staticProvider{name: "p", targets: []Target{{Name: "a", URL: "http://a"}}}
+	set.refresh(provider)
+
+	provider.targets, provider.err = nil, errors.New("unreachable")
+	set.refresh(provider)
+	assert.Equal(t, 1, len(set.Targets()), "previous targets should be kept")
+
+	provider.targets, provider.err = []Target{}, nil
+	set.refresh(provider)
+	assert.Equal(t, 0, len(set.Targets()), "targets should be removed")
+}
+
+func TestSetRun(t *testing.T) {
+	set := NewSet()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		set.Run(ctx, &staticProvider{name: "p", targets: []Target{{Name: "a", URL: "http://a"}}}, time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, 1, len(set.Targets()), "targets should be refreshed")
+}
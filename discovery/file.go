@@ -0,0 +1,212 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	addressLabel     = "__address__"
+	schemeLabel      = "__scheme__"
+	metricsPathLabel = "__metrics_path__"
+	paramLabelPrefix = "__param_"
+	reservedPrefix   = "__"
+	jobLabel         = "job"
+	instanceLabel    = "instance"
+)
+
+// TargetGroup is the Prometheus representation of a group of targets
+// sharing the same labels, as found in file_sd and http_sd documents
+type TargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// NewTarget generates a Target from a Prometheus address and its labels
+// following the Prometheus relabeling defaults:
+//  - the URL is built from __scheme__, __address__, __metrics_path__ and
+//    the __param_* labels
+//  - the Name is the job label, or the address when missing
+//  - the instance label defaults to the address
+//  - every label starting with __ is dropped
+func NewTarget(address string, labels map[string]string) Target {
+	scheme := "http"
+	if s, ok := labels[schemeLabel]; ok && s != "" {
+		scheme = s
+	}
+	path := "/metrics"
+	if p, ok := labels[metricsPathLabel]; ok && p != "" {
+		path = p
+	}
+
+	u := &url.URL{Scheme: scheme, Host: address, Path: path}
+	if strings.Contains(address, "://") {
+		if parsed, err := url.Parse(address); err == nil {
+			u = parsed
+		}
+	}
+
+	params := u.Query()
+	target := Target{
+		Name:   address,
+		Labels: make(map[string]string),
+	}
+	for name, value := range labels {
+		if strings.HasPrefix(name, paramLabelPrefix) {
+			params.Set(strings.TrimPrefix(name, paramLabelPrefix), value)
+			continue
+		}
+		if strings.HasPrefix(name, reservedPrefix) {
+			continue
+		}
+		target.Labels[name] = value
+	}
+	u.RawQuery = params.Encode()
+	target.URL = u.String()
+
+	if job, ok := target.Labels[jobLabel]; ok && job != "" {
+		target.Name = job
+	}
+	if _, ok := target.Labels[instanceLabel]; !ok {
+		target.Labels[instanceLabel] = address
+	}
+	return target
+}
+
+// targets expands the group in the list of targets it represents
+func (tg *TargetGroup) targets() []Target {
+	out := make([]Target, 0, len(tg.Targets))
+	for _, address := range tg.Targets {
+		out = append(out, NewTarget(address, tg.Labels))
+	}
+	return out
+}
+
+// FileProvider discovers targets from Prometheus file_sd_configs compatible
+// JSON or YAML files. As Prometheus does, the files are watched for changes,
+// and every refresh rereads the files matching the patterns so that the
+// changes the watch misses are picked up as well.
+type FileProvider struct {
+	patterns []string
+}
+
+// NewFileProvider generates a new FileProvider for the given glob patterns
+func NewFileProvider(patterns []string) *FileProvider {
+	return &FileProvider{
+		patterns: patterns,
+	}
+}
+
+// Name identifies the provider inside a Set
+func (fp *FileProvider) Name() string {
+	return "file_sd"
+}
+
+// Refresh returns the targets described by all the files matching the
+// provider patterns. Files that cannot be read or parsed are skipped.
+func (fp *FileProvider) Refresh() ([]Target, error) {
+	targets := make([]Target, 0)
+	for _, pattern := range fp.patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			groups, err := readTargetGroups(file)
+			if err != nil {
+				logrus.Errorf("file_sd: skipping %s: %v", file, err)
+				continue
+			}
+			for _, group := range groups {
+				targets = append(targets, group.targets()...)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// Watch watches the directories of the patterns, rather than the files that
+// are often replaced, and sends on the returned channel whenever a file
+// matching the patterns changes. When the directories cannot be watched the
+// files are only reread every refresh.
+func (fp *FileProvider) Watch(ctx context.Context) <-chan struct{} {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.Errorf("file_sd: cannot watch the files, rereading them every refresh only: %v", err)
+		return nil
+	}
+	watched := make(map[string]bool)
+	for _, pattern := range fp.patterns {
+		dir := filepath.Dir(pattern)
+		if watched[dir] {
+			continue
+		}
+		watched[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			logrus.Errorf("file_sd: cannot watch %s, rereading it every refresh only: %v", dir, err)
+		}
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watcher.Events:
+				if !fp.matches(event.Name) {
+					continue
+				}
+				// a pending change is enough for the next refresh
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case err := <-watcher.Errors:
+				logrus.Errorf("file_sd: watch failed with %v", err)
+			}
+		}
+	}()
+	return changes
+}
+
+// matches tells whether the file matches any of the patterns
+func (fp *FileProvider) matches(file string) bool {
+	for _, pattern := range fp.patterns {
+		if ok, _ := filepath.Match(filepath.Clean(pattern), filepath.Clean(file)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func readTargetGroups(file string) ([]TargetGroup, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []TargetGroup
+	switch ext := filepath.Ext(file); strings.ToLower(ext) {
+	case ".json":
+		err = json.Unmarshal(content, &groups)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &groups)
+	default:
+		err = fmt.Errorf("unsupported file extension %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
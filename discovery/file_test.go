@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonTargets = `[
+  {
+    "targets": ["10.0.0.1:9100", "10.0.0.2:9100"],
+    "labels": {"job": "node", "env": "prod"}
+  }
+]`
+
+const yamlTargets = `
+- targets: ["db:9187"]
+  labels:
+    job: postgres
+    __scheme__: https
+    __metrics_path__: /probe
+    __param_module: pg
+`
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "file_sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestNewTarget(t *testing.T) {
+	target := NewTarget("db:9187", map[string]string{
+		"job":              "postgres",
+		"__scheme__":       "https",
+		"__metrics_path__": "/probe",
+		"__param_module":   "pg",
+		"__meta_foo":       "bar",
+	})
+
+	assert.Equal(t, "postgres", target.Name, "the job should be used as name")
+	assert.Equal(t, "https://db:9187/probe?module=pg", target.URL, "url should be built from the labels")
+	assert.Equal(t, map[string]string{"job": "postgres", "instance": "db:9187"}, target.Labels, "reserved labels should be dropped")
+}
+
+func TestNewTargetDefaults(t *testing.T) {
+	target := NewTarget("host:8080", nil)
+
+	assert.Equal(t, "host:8080", target.Name, "the address should be used as name")
+	assert.Equal(t, "http://host:8080/metrics", target.URL, "url should use the defaults")
+	assert.Equal(t, map[string]string{"instance": "host:8080"}, target.Labels, "instance should default to the address")
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "node.json"), []byte(jsonTargets), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "db.yml"), []byte(yamlTargets), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644)
+
+	provider := NewFileProvider([]string{filepath.Join(dir, "*")})
+	targets, err := provider.Refresh()
+
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 3, len(targets), "there should be exactly 3 targets")
+
+	urls := make(map[string]Target)
+	for _, target := range targets {
+		urls[target.URL] = target
+	}
+	assert.Equal(t, "node", urls["http://10.0.0.1:9100/metrics"].Name, "json targets should be read")
+	assert.Equal(t, "prod", urls["http://10.0.0.2:9100/metrics"].Labels["env"], "json labels should be read")
+	assert.Equal(t, "postgres", urls["https://db:9187/probe?module=pg"].Name, "yaml targets should be read")
+}
+
+func TestFileProviderPicksUpChanges(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "targets.json")
+	provider := NewFileProvider([]string{filepath.Join(dir, "*.json")})
+
+	targets, _ := provider.Refresh()
+	assert.Equal(t, 0, len(targets), "there should be no targets")
+
+	ioutil.WriteFile(file, []byte(jsonTargets), 0644)
+	targets, _ = provider.Refresh()
+	assert.Equal(t, 2, len(targets), "added files should be picked up")
+
+	os.Remove(file)
+	targets, _ = provider.Refresh()
+	assert.Equal(t, 0, len(targets), "removed files should drop their targets")
+}
+
+func TestFileProviderWatch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	set := NewSet()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go set.Run(ctx, NewFileProvider([]string{filepath.Join(dir, "*.json")}), time.Hour)
+	time.Sleep(50 * time.Millisecond)
+
+	ioutil.WriteFile(filepath.Join(dir, "targets.json"), []byte(jsonTargets), 0644)
+	for i := 0; i < 100 && len(set.Targets()) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, 2, len(set.Targets()), "the changes should be picked up before the refresh interval")
+}
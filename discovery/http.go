@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPProvider discovers targets by polling a Prometheus http_sd compatible
+// endpoint. The endpoint returns the complete list of target groups, so
+// targets missing from a response are removed.
+type HTTPProvider struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+}
+
+// NewHTTPProvider generates a new HTTPProvider for the given endpoint that is
+// going to be polled every interval
+func NewHTTPProvider(url string, interval time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+	}
+}
+
+// Name identifies the provider inside a Set
+func (hp *HTTPProvider) Name() string {
+	return "http_sd " + hp.url
+}
+
+// Refresh returns the targets currently returned by the endpoint
+func (hp *HTTPProvider) Refresh() ([]Target, error) {
+	req, err := http.NewRequest(http.MethodGet, hp.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Prometheus-Refresh-Interval-Seconds", strconv.FormatFloat(hp.interval.Seconds(), 'f', -1, 64))
+
+	resp, err := hp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+
+	var groups []TargetGroup
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0)
+	for _, group := range groups {
+		targets = append(targets, group.targets()...)
+	}
+	return targets, nil
+}
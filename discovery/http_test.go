@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	body := jsonTargets
+	var refresh string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refresh = r.Header.Get("X-Prometheus-Refresh-Interval-Seconds")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL, 30*time.Second)
+	targets, err := provider.Refresh()
+
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, "30", refresh, "the refresh interval should be sent")
+	assert.Equal(t, 2, len(targets), "there should be exactly 2 targets")
+	assert.Equal(t, "node", targets[0].Name, "the job should be used as name")
+	assert.Equal(t, "prod", targets[0].Labels["env"], "labels should be kept")
+
+	body = `[{"targets": ["10.0.0.3:9100"], "labels": {"job": "node"}}]`
+	targets, err = provider.Refresh()
+
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 1, len(targets), "removed targets should be dropped")
+	assert.Equal(t, "http://10.0.0.3:9100/metrics", targets[0].URL, "added targets should be returned")
+}
+
+func TestHTTPProviderErrors(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, "{")
+	}))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL, time.Second)
+
+	_, err := provider.Refresh()
+	assert.NotEmpty(t, err, "non 200 responses should fail")
+
+	status = http.StatusOK
+	_, err = provider.Refresh()
+	assert.NotEmpty(t, err, "malformed responses should fail")
+}
+
+func TestHTTPProviderInSet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, jsonTargets)
+	}))
+	defer server.Close()
+
+	set := NewSet()
+	set.refresh(NewHTTPProvider(server.URL, time.Second))
+	set.refresh(NewHTTPProvider(server.URL+"/other", time.Second))
+
+	assert.Equal(t, 4, len(set.Targets()), "every endpoint should keep its own targets")
+}
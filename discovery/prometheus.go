@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// targetsResponse is the subset of the /api/v1/targets response we rely on
+type targetsResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ActiveTargets []struct {
+			Labels    map[string]string `json:"labels"`
+			ScrapeURL string            `json:"scrapeUrl"`
+		} `json:"activeTargets"`
+	} `json:"data"`
+}
+
+// PrometheusProvider discovers targets by polling the /api/v1/targets
+// endpoint of a running Prometheus server, so that promrec records exactly
+// what the server is scraping
+type PrometheusProvider struct {
+	url    string
+	job    *regexp.Regexp
+	client *http.Client
+}
+
+// NewPrometheusProvider generates a new PrometheusProvider for the server
+// at the given base URL. Only the active targets whose job fully matches the
+// given regular expression are returned.
+func NewPrometheusProvider(url string, job string, timeout time.Duration) (*PrometheusProvider, error) {
+	re, err := regexp.Compile("^(?:" + job + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &PrometheusProvider{
+		url:    strings.TrimRight(url, "/"),
+		job:    re,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Name identifies the provider inside a Set
+func (pp *PrometheusProvider) Name() string {
+	return "prometheus_sd " + pp.url
+}
+
+// Refresh returns the active targets of the Prometheus server
+func (pp *PrometheusProvider) Refresh() ([]Target, error) {
+	resp, err := pp.client.Get(pp.url + "/api/v1/targets?state=active")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+
+	var response targetsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("server returned status %q: %s", response.Status, response.Error)
+	}
+
+	targets := make([]Target, 0)
+	for _, active := range response.Data.ActiveTargets {
+		job := active.Labels[jobLabel]
+		if !pp.job.MatchString(job) {
+			continue
+		}
+
+		labels := make(map[string]string, len(active.Labels))
+		for name, value := range active.Labels {
+			labels[name] = value
+		}
+		targets = append(targets, Target{
+			Name:   job,
+			URL:    active.ScrapeURL,
+			Labels: labels,
+		})
+	}
+	return targets, nil
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const activeTargets = `{
+  "status": "success",
+  "data": {
+    "activeTargets": [
+      {
+        "discoveredLabels": {"__address__": "10.0.0.1:9100", "job": "node"},
+        "labels": {"instance": "10.0.0.1:9100", "job": "node", "env": "prod"},
+        "scrapeUrl": "http://10.0.0.1:9100/metrics",
+        "health": "up"
+      },
+      {
+        "discoveredLabels": {"__address__": "localhost:9090", "job": "prometheus"},
+        "labels": {"instance": "localhost:9090", "job": "prometheus"},
+        "scrapeUrl": "http://localhost:9090/metrics",
+        "health": "up"
+      }
+    ],
+    "droppedTargets": []
+  }
+}`
+
+func prometheusServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/targets" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestPrometheusProvider(t *testing.T) {
+	server := prometheusServer(activeTargets)
+	defer server.Close()
+
+	provider, err := NewPrometheusProvider(server.URL+"/", ".*", time.Second)
+	assert.Empty(t, err, "should not be any error")
+
+	targets, err := provider.Refresh()
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 2, len(targets), "all the active targets should be returned")
+	assert.Equal(t, "node", targets[0].Name, "the job should be used as name")
+	assert.Equal(t, "http://10.0.0.1:9100/metrics", targets[0].URL, "the scrape url should be used")
+	assert.Equal(t, "prod", targets[0].Labels["env"], "the target labels should be kept")
+}
+
+func TestPrometheusProviderJobFilter(t *testing.T) {
+	server := prometheusServer(activeTargets)
+	defer server.Close()
+
+	provider, _ := NewPrometheusProvider(server.URL, "node|postgres", time.Second)
+	targets, _ := provider.Refresh()
+	assert.Equal(t, 1, len(targets), "only matching jobs should be returned")
+	assert.Equal(t, "node", targets[0].Name, "only matching jobs should be returned")
+
+	provider, _ = NewPrometheusProvider(server.URL, "no", time.Second)
+	targets, _ = provider.Refresh()
+	assert.Equal(t, 0, len(targets), "the job regex should be anchored")
+
+	_, err := NewPrometheusProvider(server.URL, "(", time.Second)
+	assert.NotEmpty(t, err, "invalid regexes should be rejected")
+}
+
+func TestPrometheusProviderErrors(t *testing.T) {
+	server := prometheusServer(`{"status": "error", "error": "boom"}`)
+	defer server.Close()
+
+	provider, _ := NewPrometheusProvider(server.URL, ".*", time.Second)
+	_, err := provider.Refresh()
+	assert.NotEmpty(t, err, "api errors should be returned")
+}
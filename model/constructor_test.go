@@ -7,6 +7,17 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestCheckVersion(t *testing.T) {
+	header := NewEmptyFrame().Header
+	assert.True(t, CheckVersion(header), "the current version should be read")
+	header.Version = [3]byte{0x00, 0x00, 0x00}
+	assert.True(t, CheckVersion(header), "the frames of older releases should be read")
+	header.Version = [3]byte{0x00, 0x01, 0x00}
+	assert.False(t, CheckVersion(header), "unknown versions should be rejected")
+	header.Magic = [3]byte{}
+	assert.False(t, CheckVersion(header), "frames without magic should be rejected")
+}
+
 func TestFrameCreation(t *testing.T) {
 	uri := "http://testtest:9090/net"
 	name := "test"
@@ -6,13 +6,29 @@ import (
 
 var (
 	magic = [3]byte{0x83, 0xF1, 0xF1}
-	// this should be bumped every time the format is not compatible anymore
-	version = [3]byte{0x00, 0x00, 0x00}
+	// this should be bumped every time the format is not compatible anymore:
+	// 0.0.1 turned the reserved bytes into the Type and Flags of the frame,
+	// which older releases would ignore
+	version = [3]byte{0x00, 0x00, 0x01}
+	// the older versions still read, the frames of 0.0.0 always having zero
+	// Type and Flags
+	compatible = [][3]byte{{0x00, 0x00, 0x00}}
 )
 
 // CheckVersion verifies that the binary format is compatible with the current release
 func CheckVersion(header *FrameHeader) bool {
-	return header.Magic == magic && header.Version == version
+	if header.Magic != magic {
+		return false
+	}
+	if header.Version == version {
+		return true
+	}
+	for _, v := range compatible {
+		if header.Version == v {
+			return true
+		}
+	}
+	return false
 }
 
 // NewFrame generates a new Frame from a given byte data
@@ -34,6 +50,13 @@ func NewFrame(name string, uri string, data []byte) *Frame {
 	}
 }
 
+// NewFailureFrame generates a new FailureFrame for a failed scrape
+func NewFailureFrame(name string, uri string, failure *ScrapeFailure) *Frame {
+	frame := NewFrame(name, uri, failure.encode())
+	frame.Header.Type = FailureFrame
+	return frame
+}
+
 // NewEmptyFrame generates a new empty frame
 func NewEmptyFrame() *Frame {
 	return NewFrame("", "", nil)
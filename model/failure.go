@@ -0,0 +1,70 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFailure is returned when the failure of a frame that is not a
+	// FailureFrame is requested
+	ErrNotFailure = errors.New("not a failure frame")
+	// ErrMalformedFailure is returned whenever the data of a FailureFrame
+	// cannot be decoded
+	ErrMalformedFailure = errors.New("malformed failure frame")
+)
+
+// Kinds of ScrapeFailure
+const (
+	// FailureTimeout is used when the target did not answer in time
+	FailureTimeout = "timeout"
+	// FailureHTTP is used when the HTTP request to the target failed
+	FailureHTTP = "http"
+	// FailureDump is used when the HTTP response could not be read
+	FailureDump = "dump"
+)
+
+// ScrapeFailure represents a scrape that did not produce any response:
+//  - a Kind that represents the class of the error
+//  - a Message that represents the error occurred
+//  - a Duration that represents how long the scrape took before failing
+type ScrapeFailure struct {
+	Kind     string
+	Message  string
+	Duration time.Duration
+}
+
+func (failure *ScrapeFailure) encode() []byte {
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.BigEndian, int64(failure.Duration))
+	writeString(buffer, failure.Kind)
+	writeString(buffer, failure.Message)
+	return buffer.Bytes()
+}
+
+// Failure decodes the ScrapeFailure stored in a FailureFrame
+func (frame *Frame) Failure() (*ScrapeFailure, error) {
+	if frame.Header.Type != FailureFrame {
+		return nil, ErrNotFailure
+	}
+
+	var (
+		buffer   = bytes.NewBuffer(frame.Data)
+		failure  = &ScrapeFailure{}
+		duration int64
+		err      error
+	)
+	if err = binary.Read(buffer, binary.BigEndian, &duration); err != nil {
+		return nil, ErrMalformedFailure
+	}
+	failure.Duration = time.Duration(duration)
+	if failure.Kind, err = readString(buffer); err != nil {
+		return nil, ErrMalformedFailure
+	}
+	if failure.Message, err = readString(buffer); err != nil {
+		return nil, ErrMalformedFailure
+	}
+	return failure, nil
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureFrame(t *testing.T) {
+	failure := &ScrapeFailure{
+		Kind:     FailureHTTP,
+		Message:  "dial tcp 127.0.0.1:9100: connect: connection refused",
+		Duration: 1500 * time.Millisecond,
+	}
+	frame := NewFailureFrame("node", "http://127.0.0.1:9100/metrics", failure)
+	assert.Equal(t, FailureFrame, frame.Header.Type, "frame type should be failure")
+
+	decoded, err := frame.Failure()
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, failure, decoded, "failure should be equal")
+}
+
+func TestFailureFrameRoundTrip(t *testing.T) {
+	buffer := filebuffer.New(make([]byte, 0))
+	failure := &ScrapeFailure{Kind: FailureTimeout, Message: "timeout", Duration: time.Second}
+
+	frame := NewFailureFrame("node", "http://127.0.0.1:9100/metrics", failure)
+	frame.Labels = map[string]string{"env": "prod"}
+	WriteFrame(buffer, frame)
+	WriteFrame(buffer, NewFrame("node", "http://127.0.0.1:9100/metrics", []byte("Foo1Bar")))
+
+	buffer.Seek(0, io.SeekStart)
+	collection := ReadAll(buffer)
+	assert.Equal(t, 2, len(collection.Data), "there should be exactly 2 frames")
+
+	decoded, err := collection.Data[0].Failure()
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, failure, decoded, "failure should be equal")
+	assert.Equal(t, "prod", collection.Data[0].Labels["env"], "labels should be kept")
+
+	_, err = collection.Data[1].Failure()
+	assert.Equal(t, ErrNotFailure, err, "scrape frames are not failures")
+}
+
+func TestMalformedFailure(t *testing.T) {
+	frame := NewFrame("node", "http://127.0.0.1:9100/metrics", []byte{0x00, 0x01})
+	frame.Header.Type = FailureFrame
+
+	_, err := frame.Failure()
+	assert.Equal(t, ErrMalformedFailure, err, "truncated failures should not be decoded")
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// ErrMalformedLabels is returned whenever the labels section of a frame
+// cannot be decoded
+var ErrMalformedLabels = errors.New("malformed labels section")
+
+// encodeLabels serializes the labels as a count followed by the length
+// prefixed names and values. Labels are sorted by name so that the same set
+// always produces the same bytes. The count and the lengths are 16 bits, an
+// error is returned for the labels not fitting.
+func encodeLabels(labels map[string]string) ([]byte, error) {
+	if len(labels) > math.MaxUint16 {
+		return nil, fmt.Errorf("%d labels, at most %d can be recorded", len(labels), math.MaxUint16)
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.BigEndian, uint16(len(names)))
+	for _, name := range names {
+		if err := writeString(buffer, name); err != nil {
+			return nil, fmt.Errorf("label name: %v", err)
+		}
+		if err := writeString(buffer, labels[name]); err != nil {
+			return nil, fmt.Errorf("label %s: %v", name, err)
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// decodeLabels reads the labels section from the beginning of data and
+// returns the labels along with the remaining bytes
+func decodeLabels(data []byte) (map[string]string, []byte, error) {
+	buffer := bytes.NewBuffer(data)
+
+	var count uint16
+	if err := binary.Read(buffer, binary.BigEndian, &count); err != nil {
+		return nil, nil, ErrMalformedLabels
+	}
+
+	labels := make(map[string]string, count)
+	for i := uint16(0); i < count; i++ {
+		name, err := readString(buffer)
+		if err != nil {
+			return nil, nil, ErrMalformedLabels
+		}
+		value, err := readString(buffer)
+		if err != nil {
+			return nil, nil, ErrMalformedLabels
+		}
+		labels[name] = value
+	}
+	return labels, buffer.Bytes(), nil
+}
+
+// writeString writes the length prefixed string, failing for the strings
+// longer than 64KiB
+func writeString(buffer *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("%d bytes long, at most %d can be recorded", len(s), math.MaxUint16)
+	}
+	binary.Write(buffer, binary.BigEndian, uint16(len(s)))
+	buffer.WriteString(s)
+	return nil
+}
+
+func readString(buffer *bytes.Buffer) (string, error) {
+	var length uint16
+	if err := binary.Read(buffer, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if int(length) > buffer.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+	return string(buffer.Next(int(length))), nil
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsRoundTrip(t *testing.T) {
+	labels := map[string]string{"job": "node", "zone": "", "instance": "10.0.0.1:9100"}
+
+	data, err := encodeLabels(labels)
+	assert.Empty(t, err, "should not be any error")
+	data = append(data, []byte("payload")...)
+	decoded, rest, err := decodeLabels(data)
+
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, labels, decoded, "labels should be equal")
+	assert.Equal(t, "payload", string(rest), "the payload should follow the labels")
+}
+
+func TestLabelsDeterministic(t *testing.T) {
+	labels := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}
+	first, _ := encodeLabels(labels)
+	second, _ := encodeLabels(labels)
+	assert.Equal(t, first, second, "encoding should be stable")
+}
+
+func TestMalformedLabels(t *testing.T) {
+	data, _ := encodeLabels(map[string]string{"job": "node"})
+
+	_, _, err := decodeLabels(data[:len(data)-2])
+	assert.Equal(t, ErrMalformedLabels, err, "truncated labels should not be decoded")
+
+	_, _, err = decodeLabels(nil)
+	assert.Equal(t, ErrMalformedLabels, err, "empty labels should not be decoded")
+}
+
+func TestLabelsTooLong(t *testing.T) {
+	_, err := encodeLabels(map[string]string{"job": strings.Repeat("a", 1<<16)})
+	assert.NotEmpty(t, err, "values longer than 64KiB should not be encoded")
+
+	labels := make(map[string]string, 1<<16)
+	for i := 0; i < 1<<16; i++ {
+		labels[strconv.Itoa(i)] = ""
+	}
+	_, err = encodeLabels(labels)
+	assert.NotEmpty(t, err, "more than 65535 labels should not be encoded")
+}
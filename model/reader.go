@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"time"
 	"unsafe"
 
 	"github.com/sirupsen/logrus"
@@ -89,7 +90,7 @@ func ReadFrame(r io.Reader) (frame *Frame, err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			if e.(error).Error() != "EOF" {
-				logrus.Errorf("Errors occured while reading frame %v, MESSAGE: %v", frame.NameString, e)
+				logrus.Errorf("Errors occured while reading frame %v, MESSAGE: %v", frame.NameString(), e)
 			}
 		}
 	}()
@@ -117,6 +118,20 @@ func ReadFrame(r io.Reader) (frame *Frame, err error) {
 		panic(err)
 	}
 
+	if frame.Header.Flags&FlagLabels != 0 {
+		frame.Labels, frame.Data, err = decodeLabels(frame.Data)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if frame.Header.Flags&FlagDuration != 0 {
+		if len(frame.Data) < 8 {
+			panic(io.ErrUnexpectedEOF)
+		}
+		frame.Duration = time.Duration(binary.BigEndian.Uint64(frame.Data))
+		frame.Data = frame.Data[8:]
+	}
+
 	logrus.Debugf("ReadFrame: frame.Data %d", frame.Data)
 
 	return
@@ -19,7 +19,7 @@ var datalen byte = byte(len(data))
 var frameSample = []byte{
 	0x83, 0xF1, 0xF1, // Magic
 	0x00, 0x00, 0x00, // Version
-	0x00, 0x00, // Reserved
+	0x00, 0x00, // Type, Flags
 	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, datalen, // Size
 	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Timestamp
 } // len(frameSample) == 20
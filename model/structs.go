@@ -1,6 +1,9 @@
 package model
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 // Collection represents the file that contains all the subsequent frames
 type Collection struct {
@@ -20,15 +23,41 @@ func (frame *Frame) NameString() string {
 // FrameHeaderLength total header length size for each frame
 const FrameHeaderLength = 128
 
+// FrameType tells how the Data section of a Frame has to be interpreted
+type FrameType uint8
+
+const (
+	// ScrapeFrame contains the HTTP response dump of a scrape
+	ScrapeFrame FrameType = iota
+	// FailureFrame contains the ScrapeFailure of a scrape that did not
+	// produce any response
+	FailureFrame
+)
+
+// FrameFlags announces the optional sections stored in front of the Data
+// section of a Frame
+type FrameFlags uint8
+
+const (
+	// FlagLabels is set whenever the Frame carries the target labels
+	FlagLabels FrameFlags = 1 << iota
+	// FlagDuration is set whenever the Frame carries the scrape duration
+	FlagDuration
+)
+
 // FrameHeader represents the header of each Frame
-//  - a Size that represents how big is the the Data section
+//  - a Type that represents how the Data section should be interpreted
+//  - the Flags that represent which optional sections precede the Data
+//  - a Size that represents how big is the the Data section, optional
+//    sections included
 //  - a Timestamp that represents when the Frame is snapshotted
 //  - a Name that represents the service that has been snapshotted
 //  - an URL that represents the service location
 type FrameHeader struct {
 	Magic     [3]byte
 	Version   [3]byte
-	Reserved  [2]byte
+	Type      FrameType
+	Flags     FrameFlags
 	Size      int64
 	Timestamp int64
 	Name      [52]byte
@@ -36,8 +65,12 @@ type FrameHeader struct {
 }
 
 // Frame represents one of the frame of the Collection file. It contains:
+//  - the Labels attached to the scraped target (eg. by service discovery)
+//  - the Duration of the scrape, when recorded
 //  - the Data slice that contains the data of the frame
 type Frame struct {
-	Header *FrameHeader
-	Data   []byte
+	Header   *FrameHeader
+	Labels   map[string]string
+	Duration time.Duration
+	Data     []byte
 }
@@ -1,9 +1,9 @@
 package model
 
 import (
+	"encoding/binary"
 	"io"
 	"sync"
-	"encoding/binary"
 
 	"github.com/sirupsen/logrus"
 )
@@ -15,11 +15,34 @@ func WriteFrame(w io.Writer, frame *Frame) error {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	err := binary.Write(w, binary.BigEndian, frame.Header)
+	header := *frame.Header
+	header.Version = version
+	data := frame.Data
+
+	// the optional sections are stored in front of the data and announced
+	// by the header flags
+	header.Flags &^= FlagLabels | FlagDuration
+	if frame.Duration > 0 {
+		header.Flags |= FlagDuration
+		duration := make([]byte, 8)
+		binary.BigEndian.PutUint64(duration, uint64(frame.Duration))
+		data = append(duration, data...)
+	}
+	if len(frame.Labels) > 0 {
+		labels, err := encodeLabels(frame.Labels)
+		if err != nil {
+			return err
+		}
+		header.Flags |= FlagLabels
+		data = append(labels, data...)
+	}
+	header.Size = int64(len(data))
+
+	err := binary.Write(w, binary.BigEndian, &header)
 	if err != nil {
 		return err
 	}
-	err = binary.Write(w, binary.BigEndian, frame.Data)
+	err = binary.Write(w, binary.BigEndian, data)
 	if err != nil {
 		return err
 	}
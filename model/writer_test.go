@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/mattetti/filebuffer"
 	"github.com/sirupsen/logrus"
@@ -51,3 +52,44 @@ func init() {
 	// Only log the warning severity or above.
 	// logrus.SetLevel(logrus.DebugLevel)
 }
+
+func TestWriteFrameWithLabels(t *testing.T) {
+	buffer := filebuffer.New(make([]byte, 0))
+	labels := map[string]string{"env": "prod", "instance": "ciao:8080"}
+
+	frame := NewFrame("foobar", "http://ciao:8080/v1/metrics", []byte("Foo1Bar"))
+	frame.Labels = labels
+	err := WriteFrame(buffer, frame)
+	assert.Empty(t, err, "error should be empty")
+	err = WriteFrame(buffer, NewFrame("foobar", "http://ciao:8080/v1/metrics", []byte("Foo2Bar")))
+	assert.Empty(t, err, "error should be empty")
+
+	buffer.Seek(0, io.SeekStart)
+	collection := ReadAll(buffer)
+
+	assert.Equal(t, 2, len(collection.Data), "there should be exactly 2 frames")
+	assert.Equal(t, FlagLabels, collection.Data[0].Header.Flags, "labels flag should be set")
+	assert.Equal(t, labels, collection.Data[0].Labels, "labels should be equal")
+	assert.Equal(t, "Foo1Bar", string(collection.Data[0].Data), "data should not contain the labels")
+	assert.Empty(t, collection.Data[1].Labels, "labels should be empty")
+	assert.Equal(t, "Foo2Bar", string(collection.Data[1].Data), "data should be equal")
+}
+
+func TestWriteFrameWithDuration(t *testing.T) {
+	buffer := filebuffer.New(make([]byte, 0))
+
+	frame := NewFrame("foobar", "http://ciao:8080/v1/metrics", []byte("Foo1Bar"))
+	frame.Labels = map[string]string{"env": "prod"}
+	frame.Duration = 250 * time.Millisecond
+	err := WriteFrame(buffer, frame)
+	assert.Empty(t, err, "error should be empty")
+
+	buffer.Seek(0, io.SeekStart)
+	collection := ReadAll(buffer)
+
+	assert.Equal(t, 1, len(collection.Data), "there should be exactly 1 frame")
+	assert.Equal(t, FlagLabels|FlagDuration, collection.Data[0].Header.Flags, "labels and duration flags should be set")
+	assert.Equal(t, 250*time.Millisecond, collection.Data[0].Duration, "duration should be equal")
+	assert.Equal(t, "prod", collection.Data[0].Labels["env"], "labels should be equal")
+	assert.Equal(t, "Foo1Bar", string(collection.Data[0].Data), "data should not contain the optional sections")
+}
@@ -0,0 +1,179 @@
+// Package otlp holds the OpenTelemetry metrics messages in their OTLP/JSON
+// encoding, as accepted by the OTLP/HTTP receivers and written by the file
+// exporters of the OpenTelemetry collector.
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// AggregationTemporalityCumulative is the temporality of the Prometheus
+// counters and histograms
+const AggregationTemporalityCumulative = 2
+
+// Uint64 is a 64 bit integer, encoded as a string as OTLP/JSON requires
+type Uint64 uint64
+
+// MarshalJSON encodes the integer as a string
+func (u Uint64) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatUint(uint64(u), 10) + `"`), nil
+}
+
+// Double is a float, NaN and infinite values are encoded as strings
+type Double float64
+
+// MarshalJSON encodes the float as a number, or as "NaN", "Infinity" and
+// "-Infinity"
+func (d Double) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(f)
+}
+
+// ExportMetricsServiceRequest is the body of an OTLP/HTTP metrics request
+type ExportMetricsServiceRequest struct {
+	ResourceMetrics []*ResourceMetrics `json:"resourceMetrics"`
+}
+
+// ResourceMetrics are the metrics of a resource
+type ResourceMetrics struct {
+	Resource     Resource        `json:"resource"`
+	ScopeMetrics []*ScopeMetrics `json:"scopeMetrics"`
+}
+
+// Resource is the entity producing the metrics
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// ScopeMetrics are the metrics of an instrumentation scope
+type ScopeMetrics struct {
+	Scope   Scope     `json:"scope"`
+	Metrics []*Metric `json:"metrics"`
+}
+
+// Scope is the instrumentation scope
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// KeyValue is an attribute, only string values are used
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is the value of an attribute
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// Metric is a metric, with exactly one of its data set
+type Metric struct {
+	Name                 string                `json:"name"`
+	Description          string                `json:"description,omitempty"`
+	Unit                 string                `json:"unit,omitempty"`
+	Gauge                *Gauge                `json:"gauge,omitempty"`
+	Sum                  *Sum                  `json:"sum,omitempty"`
+	Histogram            *Histogram            `json:"histogram,omitempty"`
+	ExponentialHistogram *ExponentialHistogram `json:"exponentialHistogram,omitempty"`
+	Summary              *Summary              `json:"summary,omitempty"`
+}
+
+// Gauge holds the points of a gauge
+type Gauge struct {
+	DataPoints []*NumberDataPoint `json:"dataPoints"`
+}
+
+// Sum holds the points of a sum, the Prometheus counters being monotonic
+// cumulative sums
+type Sum struct {
+	DataPoints             []*NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                `json:"aggregationTemporality"`
+	IsMonotonic            bool               `json:"isMonotonic"`
+}
+
+// NumberDataPoint is a point of a gauge or a sum
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64     `json:"timeUnixNano"`
+	AsDouble          Double     `json:"asDouble"`
+}
+
+// Histogram holds the points of an explicit buckets histogram
+type Histogram struct {
+	DataPoints             []*HistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+}
+
+// HistogramDataPoint is a point of a histogram, the BucketCounts are not
+// cumulative and the last bucket has no explicit bound
+type HistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64     `json:"timeUnixNano"`
+	Count             Uint64     `json:"count"`
+	Sum               *Double    `json:"sum,omitempty"`
+	BucketCounts      []Uint64   `json:"bucketCounts"`
+	ExplicitBounds    []Double   `json:"explicitBounds"`
+}
+
+// ExponentialHistogram holds the points of an exponential histogram
+type ExponentialHistogram struct {
+	DataPoints             []*ExponentialHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                              `json:"aggregationTemporality"`
+}
+
+// ExponentialHistogramDataPoint is a point of an exponential histogram, the
+// bucket i covering (base^i, base^(i+1)] with base 2^(2^-Scale)
+type ExponentialHistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64     `json:"timeUnixNano"`
+	Count             Uint64     `json:"count"`
+	Sum               *Double    `json:"sum,omitempty"`
+	Scale             int32      `json:"scale"`
+	ZeroCount         Uint64     `json:"zeroCount"`
+	ZeroThreshold     Double     `json:"zeroThreshold,omitempty"`
+	Positive          Buckets    `json:"positive"`
+	Negative          Buckets    `json:"negative"`
+}
+
+// Buckets are consecutive buckets of an exponential histogram starting at
+// index Offset
+type Buckets struct {
+	Offset       int32    `json:"offset"`
+	BucketCounts []Uint64 `json:"bucketCounts"`
+}
+
+// Summary holds the points of a summary
+type Summary struct {
+	DataPoints []*SummaryDataPoint `json:"dataPoints"`
+}
+
+// SummaryDataPoint is a point of a summary
+type SummaryDataPoint struct {
+	Attributes        []KeyValue        `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64            `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64            `json:"timeUnixNano"`
+	Count             Uint64            `json:"count"`
+	Sum               Double            `json:"sum"`
+	QuantileValues    []ValueAtQuantile `json:"quantileValues"`
+}
+
+// ValueAtQuantile is a quantile of a summary
+type ValueAtQuantile struct {
+	Quantile Double `json:"quantile"`
+	Value    Double `json:"value"`
+}
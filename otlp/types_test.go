@@ -0,0 +1,22 @@
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumberDataPointJSON(t *testing.T) {
+	data, err := json.Marshal([]*NumberDataPoint{
+		{TimeUnixNano: 1500000000, AsDouble: 0.5},
+		{StartTimeUnixNano: 1, TimeUnixNano: 2, AsDouble: Double(math.NaN())},
+		{TimeUnixNano: 2, AsDouble: Double(math.Inf(-1))},
+	})
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, `[{"timeUnixNano":"1500000000","asDouble":0.5},`+
+		`{"startTimeUnixNano":"1","timeUnixNano":"2","asDouble":"NaN"},`+
+		`{"timeUnixNano":"2","asDouble":"-Infinity"}]`, string(data),
+		"integers should be strings and special floats should be named")
+}
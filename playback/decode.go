@@ -0,0 +1,132 @@
+package playback
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	cm "github.com/Cleafy/promqueen/model"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// exportedLabelPrefix is prepended to the exposed labels conflicting with the
+// target ones, as Prometheus does when honor_labels is false
+const exportedLabelPrefix = "exported_"
+
+// Decode decodes the samples contained in the response dump of a scrape
+// frame. The exposition format (OpenMetrics, protobuf or text) is chosen from
+// the recorded Content-Type header, falling back to the text format. As
+// Prometheus does, the body of non 2xx responses is ignored.
+//
+// The frame timestamp is used for the samples without an explicit one. With
+// honorTimestamps the timestamps exposed by the target (eg. by /federate)
+// are kept, otherwise every sample gets the frame timestamp, as the
+// honor_timestamps scrape option does in Prometheus.
+func Decode(frame *cm.Frame, honorTimestamps bool) (*Scrape, error) {
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(frame.Data)), &http.Request{})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	scrape := &Scrape{StatusCode: response.StatusCode}
+	if !scrape.Up() {
+		logrus.Infof("Scrape of %s returned HTTP status %s", frame.URIString(), response.Status)
+		return scrape, nil
+	}
+
+	timestamp := model.TimeFromUnix(frame.Header.Timestamp)
+	if mediatype, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediatype == OpenMetricsType {
+		err = parseOpenMetrics(response.Body, timestamp, scrape)
+	} else {
+		err = decodeExpfmt(response, timestamp, scrape)
+	}
+	if err != nil {
+		logrus.Errorf("Errors occured while decoding %s, MESSAGE: %v", frame.URIString(), err)
+	}
+	if !honorTimestamps {
+		scrape.setTimestamp(timestamp)
+	}
+	logrus.Printf("%d metrics unmarshalled for %s", len(scrape.Metadata), frame.URIString())
+
+	// exemplars share the metric of their sample, so they get the target
+	// labels as well
+	target := TargetMetric(frame)
+	for _, s := range scrape.Samples {
+		applyTarget(s.Metric, target)
+	}
+	for _, h := range scrape.Histograms {
+		applyTarget(h.Metric, target)
+		for _, s := range h.Classic {
+			applyTarget(s.Metric, target)
+		}
+	}
+	return scrape, nil
+}
+
+// decodeExpfmt decodes the Prometheus text and protobuf formats, chosen from
+// the recorded Content-Type header and falling back to the text format.
+// Native histograms, only available in the protobuf format, are decoded
+// apart since expfmt does not support them.
+func decodeExpfmt(response *http.Response, timestamp model.Time, scrape *Scrape) error {
+	format := expfmt.ResponseFormat(response.Header)
+	if format == expfmt.FmtUnknown {
+		format = expfmt.FmtText
+	}
+
+	var decErr error
+	families := make([]*dto.MetricFamily, 0)
+	dec := expfmt.NewDecoder(response.Body, format)
+	for {
+		family := &dto.MetricFamily{}
+		err := dec.Decode(family)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			decErr = err
+			break
+		}
+		scrape.Histograms = append(scrape.Histograms, extractHistograms(family, timestamp)...)
+		families = append(families, family)
+		scrape.Metadata = append(scrape.Metadata, &Metadata{
+			MetricFamily: family.GetName(),
+			Type:         metadataType(family.GetType()),
+			Help:         family.GetHelp(),
+		})
+	}
+
+	samples, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{
+		Timestamp: timestamp,
+	}, families...)
+	scrape.Samples = samples
+	if decErr != nil {
+		return decErr
+	}
+	return err
+}
+
+// metadataType converts the protobuf metric type to the OpenMetrics one
+func metadataType(t dto.MetricType) string {
+	if t == dto.MetricType_UNTYPED {
+		return "unknown"
+	}
+	return strings.ToLower(t.String())
+}
+
+// applyTarget attaches the target labels to the metric, exposed labels
+// conflicting with the target ones are renamed to exported_<name>
+func applyTarget(metric model.Metric, target model.Metric) {
+	for name, value := range target {
+		if exposed, ok := metric[name]; ok {
+			metric[exportedLabelPrefix+name] = exposed
+		}
+		metric[name] = value
+	}
+}
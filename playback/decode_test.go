@@ -0,0 +1,166 @@
+package playback
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"testing"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const textBody = `# TYPE http_requests_total counter
+http_requests_total{code="200",job="app"} 10
+http_requests_total{code="500"} 2
+# TYPE temperature gauge
+temperature 21.5
+`
+
+// dumpFrame generates a scrape frame as recorded by promrec
+func dumpFrame(status int, contentType string, body []byte) *cm.Frame {
+	response := &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if contentType != "" {
+		response.Header.Set("Content-Type", contentType)
+	}
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		panic(err)
+	}
+	frame := cm.NewFrame("app", "http://10.0.0.1:8080/metrics", dump)
+	frame.Labels = map[string]string{"env": "prod"}
+	return frame
+}
+
+func samplesByName(samples model.Vector) map[string]model.Vector {
+	out := make(map[string]model.Vector)
+	for _, s := range samples {
+		name := string(s.Metric[model.MetricNameLabel])
+		out[name] = append(out[name], s)
+	}
+	return out
+}
+
+func TestDecodeText(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtText), []byte(textBody))
+
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+	assert.True(t, scrape.Up(), "the scrape should be up")
+	assert.Equal(t, 3, len(scrape.Samples), "there should be exactly 3 samples")
+
+	byName := samplesByName(scrape.Samples)
+	temperature := byName["temperature"][0]
+	assert.Equal(t, model.SampleValue(21.5), temperature.Value, "values should be decoded")
+	assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), temperature.Timestamp, "the frame timestamp should be used")
+	assert.Equal(t, model.LabelValue("app"), temperature.Metric[JobLabel], "the job label should be set")
+	assert.Equal(t, model.LabelValue("http://10.0.0.1:8080/metrics"), temperature.Metric[URLLabel], "the url label should be set")
+	assert.Equal(t, model.LabelValue("prod"), temperature.Metric["env"], "the target labels should be set")
+}
+
+func TestDecodeWithoutContentType(t *testing.T) {
+	scrape, err := Decode(dumpFrame(http.StatusOK, "", []byte(textBody)), true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 3, len(scrape.Samples), "the text format should be the fallback")
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	family := &dto.MetricFamily{
+		Name: proto.String("temperature"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("room"), Value: proto.String("kitchen")}},
+			Gauge: &dto.Gauge{Value: proto.Float64(21.5)},
+		}},
+	}
+	body := &bytes.Buffer{}
+	expfmt.NewEncoder(body, expfmt.FmtProtoDelim).Encode(family)
+
+	scrape, err := Decode(dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), body.Bytes()), true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 1, len(scrape.Samples), "there should be exactly 1 sample")
+	assert.Equal(t, model.SampleValue(21.5), scrape.Samples[0].Value, "values should be decoded")
+	assert.Equal(t, model.LabelValue("kitchen"), scrape.Samples[0].Metric["room"], "labels should be decoded")
+	assert.Equal(t, model.LabelValue("app"), scrape.Samples[0].Metric[JobLabel], "the job label should be set")
+}
+
+func TestDecodeErrorStatus(t *testing.T) {
+	scrape, err := Decode(dumpFrame(http.StatusServiceUnavailable, string(expfmt.FmtText), []byte(textBody)), true)
+	assert.Empty(t, err, "should not be any error")
+	assert.False(t, scrape.Up(), "the scrape should be down")
+	assert.Empty(t, scrape.Samples, "the body of non 2xx responses should be ignored")
+}
+
+func TestDecodeMalformedDump(t *testing.T) {
+	_, err := Decode(cm.NewFrame("app", "http://10.0.0.1:8080/metrics", []byte("garbage")), true)
+	assert.NotEmpty(t, err, "malformed dumps should fail")
+}
+
+const timestampedBody = `# TYPE temperature gauge
+temperature{room="kitchen"} 21.5 1500000000000
+temperature{room="garage"} 12
+`
+
+func TestDecodeHonorTimestamps(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtText), []byte(timestampedBody))
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+
+	for _, s := range scrape.Samples {
+		if s.Metric["room"] == "kitchen" {
+			assert.Equal(t, model.Time(1500000000000), s.Timestamp, "the exposed timestamp should be kept")
+		} else {
+			assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), s.Timestamp, "the frame timestamp should be used")
+		}
+	}
+}
+
+func TestDecodeIgnoreTimestamps(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtText), []byte(timestampedBody))
+	scrape, err := Decode(frame, false)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 2, len(scrape.Samples), "there should be exactly 2 samples")
+
+	for _, s := range scrape.Samples {
+		assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), s.Timestamp, "the frame timestamp should be forced")
+	}
+}
+
+func TestDecodeIgnoreTimestampsOpenMetrics(t *testing.T) {
+	body := "# TYPE temperature gauge\ntemperature 21.5 1500000000.5 # {trace_id=\"abc\"} 21.5 1500000000.1\n# EOF\n"
+	frame := dumpFrame(http.StatusOK, OpenMetricsType, []byte(body))
+	scrape, err := Decode(frame, false)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), scrape.Samples[0].Timestamp, "the frame timestamp should be forced")
+	assert.Equal(t, model.Time(1500000000100), scrape.Exemplars[0].Timestamp, "exemplars should keep their timestamp")
+}
+
+func TestApplyTarget(t *testing.T) {
+	metric := model.Metric{"__name__": "http_requests_total", "job": "exposed", "code": "200"}
+	applyTarget(metric, model.Metric{"job": "app", "url": "http://10.0.0.1:8080/metrics"})
+	assert.Equal(t, model.Metric{
+		"__name__":     "http_requests_total",
+		"job":          "app",
+		"url":          "http://10.0.0.1:8080/metrics",
+		"exported_job": "exposed",
+		"code":         "200",
+	}, metric, "the target labels should win, the conflicting exposed ones being exported")
+
+	metric = model.Metric{"__name__": "up"}
+	applyTarget(metric, model.Metric{"job": "app"})
+	assert.Equal(t, model.Metric{"__name__": "up", "job": "app"}, metric, "no exported label should be added without conflicts")
+}
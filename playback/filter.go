@@ -0,0 +1,116 @@
+package playback
+
+import (
+	"regexp"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/metric"
+)
+
+// Filter restricts the playback to:
+//  - the frames whose Name and URI match the regexes, nil matching any
+//  - the frames between Start and End (included), zero for no bound, once
+//    their timestamp is moved by the Offset of the playback (see Shift)
+//  - the series matching any of the Matchers sets, all of them when empty
+type Filter struct {
+	Name     *regexp.Regexp
+	URI      *regexp.Regexp
+	Start    model.Time
+	End      model.Time
+	Offset   time.Duration
+	Matchers []metric.LabelMatchers
+}
+
+// Frame tells whether the frame passes the filter, before decoding it
+func (f *Filter) Frame(frame *cm.Frame) bool {
+	if f == nil {
+		return true
+	}
+	if f.Name != nil && !f.Name.MatchString(frame.NameString()) {
+		return false
+	}
+	if f.URI != nil && !f.URI.MatchString(frame.URIString()) {
+		return false
+	}
+	timestamp := model.TimeFromUnix(frame.Header.Timestamp + int64(f.Offset/time.Second))
+	if f.Start != 0 && timestamp.Before(f.Start) {
+		return false
+	}
+	if f.End != 0 && timestamp.After(f.End) {
+		return false
+	}
+	return true
+}
+
+// Frames returns the frames passing the filter
+func (f *Filter) Frames(frames <-chan cm.Frame) <-chan cm.Frame {
+	filtered := make(chan cm.Frame)
+	go func() {
+		defer close(filtered)
+		for frame := range frames {
+			if f.Frame(&frame) {
+				filtered <- frame
+			}
+		}
+	}()
+	return filtered
+}
+
+// Metric tells whether the series passes the filter
+func (f *Filter) Metric(m model.Metric) bool {
+	if f == nil || len(f.Matchers) == 0 {
+		return true
+	}
+	for _, matchers := range f.Matchers {
+		matches := true
+		for _, matcher := range matchers {
+			if !matcher.Match(m[matcher.Name]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Samples returns the samples of the series passing the filter
+func (f *Filter) Samples(samples model.Vector) model.Vector {
+	if f == nil || len(f.Matchers) == 0 {
+		return samples
+	}
+	filtered := samples[:0]
+	for _, s := range samples {
+		if f.Metric(s.Metric) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// Scrape drops the samples, histograms and exemplars of the series not
+// passing the filter from the scrape
+func (f *Filter) Scrape(scrape *Scrape) {
+	if f == nil || len(f.Matchers) == 0 {
+		return
+	}
+	scrape.Samples = f.Samples(scrape.Samples)
+	histograms := scrape.Histograms[:0]
+	for _, h := range scrape.Histograms {
+		if f.Metric(h.Metric) {
+			histograms = append(histograms, h)
+		}
+	}
+	scrape.Histograms = histograms
+	exemplars := scrape.Exemplars[:0]
+	for _, e := range scrape.Exemplars {
+		if f.Metric(e.Metric) {
+			exemplars = append(exemplars, e)
+		}
+	}
+	scrape.Exemplars = exemplars
+}
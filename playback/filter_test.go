@@ -0,0 +1,61 @@
+package playback
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterFrame(t *testing.T) {
+	filter := &Filter{
+		Name:  regexp.MustCompile("^(?:node|app)$"),
+		URI:   regexp.MustCompile("^(?:http://10.0.0.1.*)$"),
+		Start: model.TimeFromUnix(1000),
+		End:   model.TimeFromUnix(2000),
+	}
+	frame := func(name, uri string, timestamp int64) *cm.Frame {
+		frame := cm.NewFrame(name, uri, nil)
+		frame.Header.Timestamp = timestamp
+		return frame
+	}
+
+	assert.True(t, filter.Frame(frame("node", "http://10.0.0.1:9100/metrics", 1500)), "the matching frames should pass")
+	assert.True(t, filter.Frame(frame("app", "http://10.0.0.1:8080/metrics", 2000)), "the bounds should be included")
+	assert.False(t, filter.Frame(frame("nodes", "http://10.0.0.1:9100/metrics", 1500)), "the name should be matched entirely")
+	assert.False(t, filter.Frame(frame("node", "http://10.0.0.2:9100/metrics", 1500)), "the frames of other URIs should be filtered")
+	assert.False(t, filter.Frame(frame("node", "http://10.0.0.1:9100/metrics", 999)), "the frames before start should be filtered")
+	assert.False(t, filter.Frame(frame("node", "http://10.0.0.1:9100/metrics", 2001)), "the frames after end should be filtered")
+	assert.True(t, (*Filter)(nil).Frame(frame("db", "", 0)), "a nil filter should let everything through")
+
+	filter.Offset = -time.Hour
+	assert.True(t, filter.Frame(frame("node", "http://10.0.0.1:9100/metrics", 5000)), "the bounds should apply to the moved times")
+	assert.False(t, filter.Frame(frame("node", "http://10.0.0.1:9100/metrics", 1500)), "the frames moved before start should be filtered")
+}
+
+func TestFilterScrape(t *testing.T) {
+	code, _ := metric.NewLabelMatcher(metric.Equal, "code", "500")
+	name, _ := metric.NewLabelMatcher(metric.RegexMatch, model.MetricNameLabel, "http_.*")
+	up, _ := metric.NewLabelMatcher(metric.Equal, model.MetricNameLabel, "up")
+	filter := &Filter{Matchers: []metric.LabelMatchers{{name, code}, {up}}}
+
+	scrape := &Scrape{
+		Samples: model.Vector{
+			sampleOf("http_requests_total", "code", "500"),
+			sampleOf("http_requests_total", "code", "200"),
+			sampleOf("rpc_requests_total", "code", "500"),
+		},
+		Histograms: []*HistogramSample{{Metric: sampleOf("http_duration_seconds").Metric}},
+		Exemplars:  []*Exemplar{{Metric: sampleOf("http_requests_total", "code", "500").Metric}},
+	}
+	filter.Scrape(scrape)
+	assert.Equal(t, model.Vector{sampleOf("http_requests_total", "code", "500")}, scrape.Samples, "only the matching samples should be kept")
+	assert.Empty(t, scrape.Histograms, "the histograms not matching should be dropped")
+	assert.Equal(t, 1, len(scrape.Exemplars), "the matching exemplars should be kept")
+
+	assert.Equal(t, 1, len(filter.Samples(model.Vector{sampleOf("up"), sampleOf("scrape_duration_seconds")})), "the sets of matchers should be or-ed")
+}
@@ -0,0 +1,220 @@
+package playback
+
+import (
+	"math"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// Span is a run of consecutive buckets of a native histogram, the Offset is
+// relative to the end of the previous span (or to index 0 for the first one)
+type Span struct {
+	Offset int32
+	Length uint32
+}
+
+// Histogram is a native histogram with absolute (non delta encoded) counts:
+//  - the Schema defining the bucket boundaries, base 2^(2^-Schema)
+//  - the ZeroThreshold and ZeroCount of the zero bucket
+//  - the overall Count and Sum of the observations
+//  - the positive and negative buckets laid out by their spans
+type Histogram struct {
+	Schema          int32
+	ZeroThreshold   float64
+	ZeroCount       float64
+	Count           float64
+	Sum             float64
+	PositiveSpans   []Span
+	PositiveBuckets []float64
+	NegativeSpans   []Span
+	NegativeBuckets []float64
+}
+
+// HistogramSample is a native histogram sample of a series. Classic holds the
+// classic _bucket, _sum and _count samples of the same observations for the
+// outputs not supporting native histograms: the exposed classic buckets when
+// available, otherwise the native buckets converted to cumulative le ones.
+type HistogramSample struct {
+	Metric    model.Metric
+	Histogram *Histogram
+	Timestamp model.Time
+	Classic   model.Vector
+}
+
+// isNativeHistogram tells whether the exposed histogram carries native
+// buckets, using the same rules as Prometheus
+func isNativeHistogram(h *dto.Histogram) bool {
+	return h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+// extractHistograms moves the native histograms out of the family, so that
+// the remaining metrics can be handled by expfmt, and returns them as
+// histogram samples
+func extractHistograms(family *dto.MetricFamily, timestamp model.Time) []*HistogramSample {
+	if family.GetType() != dto.MetricType_HISTOGRAM {
+		return nil
+	}
+
+	var histograms []*HistogramSample
+	metrics := family.Metric[:0]
+	for _, m := range family.Metric {
+		if m.GetHistogram() == nil || !isNativeHistogram(m.GetHistogram()) {
+			metrics = append(metrics, m)
+			continue
+		}
+
+		metric := model.Metric{model.MetricNameLabel: model.LabelValue(family.GetName())}
+		for _, lp := range m.GetLabel() {
+			metric[model.LabelName(lp.GetName())] = model.LabelValue(lp.GetValue())
+		}
+		ts := timestamp
+		if m.TimestampMs != nil {
+			ts = model.Time(m.GetTimestampMs())
+		}
+
+		histogram := histogramFromDTO(m.GetHistogram())
+		histograms = append(histograms, &HistogramSample{
+			Metric:    metric,
+			Histogram: histogram,
+			Timestamp: ts,
+			Classic:   classicSamples(family, m, histogram, ts),
+		})
+	}
+	family.Metric = metrics
+	return histograms
+}
+
+// histogramFromDTO converts the delta encoded integer counts, or the float
+// counts, of the exposed histogram into absolute counts
+func histogramFromDTO(h *dto.Histogram) *Histogram {
+	histogram := &Histogram{
+		Schema:        h.GetSchema(),
+		ZeroThreshold: h.GetZeroThreshold(),
+		ZeroCount:     float64(h.GetZeroCount()),
+		Count:         float64(h.GetSampleCount()),
+		Sum:           h.GetSampleSum(),
+		PositiveSpans: spansFromDTO(h.GetPositiveSpan()),
+		NegativeSpans: spansFromDTO(h.GetNegativeSpan()),
+	}
+	if h.GetSampleCountFloat() > 0 {
+		histogram.Count = h.GetSampleCountFloat()
+	}
+	if h.GetZeroCountFloat() > 0 {
+		histogram.ZeroCount = h.GetZeroCountFloat()
+	}
+
+	if len(h.GetPositiveCount()) > 0 || len(h.GetNegativeCount()) > 0 {
+		histogram.PositiveBuckets = h.GetPositiveCount()
+		histogram.NegativeBuckets = h.GetNegativeCount()
+	} else {
+		histogram.PositiveBuckets = absoluteCounts(h.GetPositiveDelta())
+		histogram.NegativeBuckets = absoluteCounts(h.GetNegativeDelta())
+	}
+	return histogram
+}
+
+func spansFromDTO(spans []*dto.BucketSpan) []Span {
+	result := make([]Span, 0, len(spans))
+	for _, s := range spans {
+		result = append(result, Span{Offset: s.GetOffset(), Length: s.GetLength()})
+	}
+	return result
+}
+
+func absoluteCounts(deltas []int64) []float64 {
+	counts := make([]float64, 0, len(deltas))
+	count := int64(0)
+	for _, delta := range deltas {
+		count += delta
+		counts = append(counts, float64(count))
+	}
+	return counts
+}
+
+// bucketIndexes returns the index of every bucket laid out by the spans
+func bucketIndexes(spans []Span) []int32 {
+	var indexes []int32
+	index := int32(0)
+	for _, s := range spans {
+		index += s.Offset
+		for i := uint32(0); i < s.Length; i++ {
+			indexes = append(indexes, index)
+			index++
+		}
+	}
+	return indexes
+}
+
+// DenseBuckets returns the index of the first bucket laid out by the spans and
+// the counts of the consecutive buckets from there, zero for the buckets in
+// the gaps between the spans
+func DenseBuckets(spans []Span, counts []float64) (int32, []float64) {
+	indexes := bucketIndexes(spans)
+	if len(indexes) == 0 {
+		return 0, nil
+	}
+	dense := make([]float64, indexes[len(indexes)-1]-indexes[0]+1)
+	for i, index := range indexes {
+		if i < len(counts) {
+			dense[index-indexes[0]] = counts[i]
+		}
+	}
+	return indexes[0], dense
+}
+
+// ClassicBuckets converts the native buckets into cumulative classic buckets
+// sorted by upper bound. The positive bucket i has upper bound base^i, the
+// negative bucket i has upper bound -base^(i-1) and the zero bucket has upper
+// bound ZeroThreshold. The +Inf bucket is not included.
+func (h *Histogram) ClassicBuckets() []*dto.Bucket {
+	base := math.Exp2(math.Exp2(float64(-h.Schema)))
+	var buckets []*dto.Bucket
+	cumulative := 0.0
+	add := func(upperBound, count float64) {
+		cumulative += count
+		c := uint64(math.Round(cumulative))
+		buckets = append(buckets, &dto.Bucket{UpperBound: &upperBound, CumulativeCount: &c})
+	}
+
+	negative := bucketIndexes(h.NegativeSpans)
+	for i := len(negative) - 1; i >= 0; i-- {
+		if i < len(h.NegativeBuckets) {
+			add(-math.Pow(base, float64(negative[i]-1)), h.NegativeBuckets[i])
+		}
+	}
+	add(h.ZeroThreshold, h.ZeroCount)
+	for i, index := range bucketIndexes(h.PositiveSpans) {
+		if i < len(h.PositiveBuckets) {
+			add(math.Pow(base, float64(index)), h.PositiveBuckets[i])
+		}
+	}
+	return buckets
+}
+
+// classicSamples returns the classic samples of the histogram metric, using
+// the exposed classic buckets when available
+func classicSamples(family *dto.MetricFamily, m *dto.Metric, histogram *Histogram, timestamp model.Time) model.Vector {
+	count := uint64(math.Round(histogram.Count))
+	buckets := m.GetHistogram().GetBucket()
+	if len(buckets) == 0 {
+		buckets = histogram.ClassicBuckets()
+	}
+
+	classic := &dto.MetricFamily{
+		Name: family.Name,
+		Type: family.Type,
+		Metric: []*dto.Metric{{
+			Label: m.Label,
+			Histogram: &dto.Histogram{
+				SampleCount: &count,
+				SampleSum:   &histogram.Sum,
+				Bucket:      buckets,
+			},
+		}},
+	}
+	samples, _ := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: timestamp}, classic)
+	return samples
+}
@@ -0,0 +1,148 @@
+package playback
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// nativeHistogramFamily returns a family with a native histogram of schema 0
+// (base 2) holding the buckets:
+//  (-1, -0.5]: 1, [-0.001, 0.001]: 1, (0.5, 1]: 2, (1, 2]: 1, (4, 8]: 4
+func nativeHistogramFamily() *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String("request_duration_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("path"), Value: proto.String("/")}},
+			Histogram: &dto.Histogram{
+				SampleCount:   proto.Uint64(9),
+				SampleSum:     proto.Float64(20),
+				Schema:        proto.Int32(0),
+				ZeroThreshold: proto.Float64(0.001),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(2)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{2, -1, 3},
+				NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(0), Length: proto.Uint32(1)}},
+				NegativeDelta: []int64{1},
+			},
+		}},
+	}
+}
+
+func encodeFamilies(families ...*dto.MetricFamily) []byte {
+	body := &bytes.Buffer{}
+	enc := expfmt.NewEncoder(body, expfmt.FmtProtoDelim)
+	for _, family := range families {
+		enc.Encode(family)
+	}
+	return body.Bytes()
+}
+
+func TestDecodeNativeHistogram(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), encodeFamilies(nativeHistogramFamily()))
+
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, scrape.Samples, "native histograms should not be decoded as samples")
+	assert.Equal(t, 1, len(scrape.Histograms), "there should be exactly 1 histogram")
+
+	h := scrape.Histograms[0]
+	assert.Equal(t, model.LabelValue("request_duration_seconds"), h.Metric[model.MetricNameLabel], "the metric name should be set")
+	assert.Equal(t, model.LabelValue("/"), h.Metric["path"], "labels should be decoded")
+	assert.Equal(t, model.LabelValue("app"), h.Metric[JobLabel], "the job label should be set")
+	assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), h.Timestamp, "the frame timestamp should be used")
+	assert.Equal(t, []float64{2, 1, 4}, h.Histogram.PositiveBuckets, "delta counts should become absolute")
+	assert.Equal(t, []float64{1}, h.Histogram.NegativeBuckets, "delta counts should become absolute")
+	assert.Equal(t, []Span{{0, 2}, {1, 1}}, h.Histogram.PositiveSpans, "spans should be decoded")
+	assert.Equal(t, 9.0, h.Histogram.Count, "the count should be decoded")
+	assert.Equal(t, 1.0, h.Histogram.ZeroCount, "the zero count should be decoded")
+
+	for _, s := range h.Classic {
+		assert.Equal(t, model.LabelValue("app"), s.Metric[JobLabel], "the classic samples should have the target labels")
+	}
+}
+
+func TestNativeHistogramClassicFallback(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), encodeFamilies(nativeHistogramFamily()))
+
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+
+	buckets := make(map[model.LabelValue]model.SampleValue)
+	byName := samplesByName(scrape.ClassicSamples())
+	for _, s := range byName["request_duration_seconds_bucket"] {
+		buckets[s.Metric[model.BucketLabel]] = s.Value
+	}
+	assert.Equal(t, map[model.LabelValue]model.SampleValue{
+		"-0.5":  1,
+		"0.001": 2,
+		"1":     4,
+		"2":     5,
+		"8":     9,
+		"+Inf":  9,
+	}, buckets, "native buckets should become cumulative classic buckets")
+	assert.Equal(t, model.SampleValue(20), byName["request_duration_seconds_sum"][0].Value, "the sum should be exposed")
+	assert.Equal(t, model.SampleValue(9), byName["request_duration_seconds_count"][0].Value, "the count should be exposed")
+}
+
+func TestNativeHistogramExposedClassicBuckets(t *testing.T) {
+	family := nativeHistogramFamily()
+	family.Metric[0].Histogram.Bucket = []*dto.Bucket{
+		{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(3)},
+		{UpperBound: proto.Float64(10), CumulativeCount: proto.Uint64(9)},
+	}
+	family.Metric[0].TimestampMs = proto.Int64(1500000000000)
+
+	scrape, err := Decode(dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), encodeFamilies(family)), true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 1, len(scrape.Histograms), "there should be exactly 1 histogram")
+	assert.Equal(t, model.Time(1500000000000), scrape.Histograms[0].Timestamp, "the exposed timestamp should be used")
+
+	buckets := samplesByName(scrape.ClassicSamples())["request_duration_seconds_bucket"]
+	assert.Equal(t, 3, len(buckets), "the exposed classic buckets should be used")
+}
+
+func TestClassicHistogramNotNative(t *testing.T) {
+	family := &dto.MetricFamily{
+		Name: proto.String("request_size_bytes"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(1),
+				SampleSum:   proto.Float64(10),
+				Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(100), CumulativeCount: proto.Uint64(1)}},
+			},
+		}},
+	}
+
+	scrape, err := Decode(dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), encodeFamilies(family)), true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, scrape.Histograms, "classic histograms should not be native")
+	assert.Equal(t, 4, len(scrape.Samples), "classic histograms should be decoded as samples")
+}
+
+func TestScrapeSeriesCountsHistograms(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, string(expfmt.FmtProtoDelim), encodeFamilies(nativeHistogramFamily()))
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+
+	byName := samplesByName(NewScrapeSeries().Samples(frame, scrape))
+	assert.Equal(t, model.SampleValue(1), byName[ScrapeSamplesScrapedMetric][0].Value, "a native histogram should count as one sample")
+	assert.Equal(t, model.SampleValue(1), byName[ScrapeSeriesAddedMetric][0].Value, "a native histogram should count as one series")
+}
+
+func TestDenseBuckets(t *testing.T) {
+	offset, counts := DenseBuckets([]Span{{Offset: -1, Length: 2}, {Offset: 2, Length: 1}}, []float64{1, 2, 3})
+	assert.Equal(t, int32(-1), offset, "the first bucket index should be returned")
+	assert.Equal(t, []float64{1, 2, 0, 0, 3}, counts, "the gaps between the spans should be zero")
+}
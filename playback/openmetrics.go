@@ -0,0 +1,347 @@
+package playback
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// OpenMetricsType is the media type of the OpenMetrics text format
+const OpenMetricsType = "application/openmetrics-text"
+
+var errMissingEOF = errors.New("openmetrics: missing # EOF")
+
+// familySuffixes lists, for every OpenMetrics type, the suffixes the samples
+// of a family can have
+var familySuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"_count", "_sum", "_created"},
+	"info":           {"_info"},
+}
+
+// Metadata represents the metadata exposed for a metric family
+type Metadata struct {
+	MetricFamily string
+	Type         string
+	Help         string
+	Unit         string
+}
+
+// Exemplar represents an exemplar attached to a sample
+//  - the Metric of the series the exemplar is attached to
+//  - the Labels of the exemplar itself (eg. trace_id)
+//  - the Value and, when exposed, the Timestamp of the exemplar
+type Exemplar struct {
+	Metric       model.Metric
+	Labels       model.LabelSet
+	Value        model.SampleValue
+	Timestamp    model.Time
+	HasTimestamp bool
+}
+
+// openMetricsParser parses the OpenMetrics text format keeping the data the
+// Prometheus text format cannot represent: exemplars, units and fractional
+// timestamps
+type openMetricsParser struct {
+	timestamp model.Time
+	scrape    *Scrape
+	metadata  map[string]*Metadata
+}
+
+// parseOpenMetrics parses the OpenMetrics exposition in r into the scrape.
+// The given timestamp is used for the samples without an explicit one. In
+// case of errors the data parsed until then is kept.
+func parseOpenMetrics(r io.Reader, timestamp model.Time, scrape *Scrape) error {
+	p := &openMetricsParser{
+		timestamp: timestamp,
+		scrape:    scrape,
+		metadata:  make(map[string]*Metadata),
+	}
+
+	reader := bufio.NewReader(r)
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return errMissingEOF
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "# EOF" {
+			return nil
+		}
+		if perr := p.parseLine(line); perr != nil {
+			return fmt.Errorf("openmetrics: line %d: %v", lineno, perr)
+		}
+		if err == io.EOF {
+			return errMissingEOF
+		}
+	}
+}
+
+func (p *openMetricsParser) parseLine(line string) error {
+	if line == "" {
+		return errors.New("empty line")
+	}
+	if strings.HasPrefix(line, "#") {
+		return p.parseComment(line)
+	}
+	return p.parseSample(line)
+}
+
+// parseComment parses the # HELP, # TYPE and # UNIT lines
+func (p *openMetricsParser) parseComment(line string) error {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || fields[0] != "#" {
+		return fmt.Errorf("invalid comment %q", line)
+	}
+	value := ""
+	if len(fields) == 4 {
+		value = fields[3]
+	}
+
+	md := p.family(fields[2])
+	switch fields[1] {
+	case "HELP":
+		md.Help = unescape(value)
+	case "TYPE":
+		md.Type = value
+	case "UNIT":
+		md.Unit = value
+	default:
+		return fmt.Errorf("invalid comment %q", line)
+	}
+	return nil
+}
+
+// family returns the metadata of the family, creating it if needed
+func (p *openMetricsParser) family(name string) *Metadata {
+	md, ok := p.metadata[name]
+	if !ok {
+		md = &Metadata{MetricFamily: name, Type: "unknown"}
+		p.metadata[name] = md
+		p.scrape.Metadata = append(p.scrape.Metadata, md)
+	}
+	return md
+}
+
+// parseSample parses the sample lines:
+//  name{labels} value [timestamp] [# {labels} value [timestamp]]
+func (p *openMetricsParser) parseSample(line string) error {
+	metric, rest, err := parseSeries(line)
+	if err != nil {
+		return err
+	}
+	if err := p.checkFamily(string(metric[model.MetricNameLabel])); err != nil {
+		return err
+	}
+
+	var exemplar string
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest, exemplar = rest[:i], rest[i+3:]
+	}
+
+	value, timestamp, hasTimestamp, err := parseValue(rest)
+	if err != nil {
+		return err
+	}
+	if !hasTimestamp {
+		timestamp = p.timestamp
+	}
+	p.scrape.Samples = append(p.scrape.Samples, &model.Sample{
+		Metric:    metric,
+		Value:     value,
+		Timestamp: timestamp,
+	})
+
+	if exemplar != "" {
+		labels, rest, err := parseLabels(exemplar)
+		if err != nil {
+			return err
+		}
+		value, timestamp, hasTimestamp, err := parseValue(rest)
+		if err != nil {
+			return err
+		}
+		p.scrape.Exemplars = append(p.scrape.Exemplars, &Exemplar{
+			Metric:       metric,
+			Labels:       labels,
+			Value:        value,
+			Timestamp:    timestamp,
+			HasTimestamp: hasTimestamp,
+		})
+	}
+	return nil
+}
+
+// checkFamily verifies that the sample name belongs to a declared family, if
+// any, or declares an unknown one
+func (p *openMetricsParser) checkFamily(name string) error {
+	if md, ok := p.metadata[name]; ok {
+		if _, typed := familySuffixes[md.Type]; typed {
+			return fmt.Errorf("sample %q without the suffix required by type %s", name, md.Type)
+		}
+		return nil
+	}
+	for i := strings.LastIndex(name, "_"); i > 0; i = strings.LastIndex(name[:i], "_") {
+		md, ok := p.metadata[name[:i]]
+		if !ok {
+			continue
+		}
+		for _, suffix := range familySuffixes[md.Type] {
+			if name[i:] == suffix {
+				return nil
+			}
+		}
+	}
+	p.family(name)
+	return nil
+}
+
+// parseSeries parses the metric name and the optional labels, returning the
+// rest of the line
+func parseSeries(line string) (model.Metric, string, error) {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return nil, "", fmt.Errorf("invalid sample %q", line)
+	}
+	name := line[:end]
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return nil, "", fmt.Errorf("invalid metric name %q", name)
+	}
+
+	metric := model.Metric{}
+	rest := line[end:]
+	if strings.HasPrefix(rest, "{") {
+		labels, r, err := parseLabels(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		metric, rest = model.Metric(labels), r
+	}
+	metric[model.MetricNameLabel] = model.LabelValue(name)
+	return metric, rest, nil
+}
+
+// parseLabels parses a {name="value",...} label set, returning the rest of
+// the line
+func parseLabels(s string) (model.LabelSet, string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, "", fmt.Errorf("expected label set, got %q", s)
+	}
+	labels := model.LabelSet{}
+	s = s[1:]
+	for {
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.Index(s, "=\"")
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label set %q", s)
+		}
+		name := model.LabelName(s[:eq])
+		if !name.IsValid() {
+			return nil, "", fmt.Errorf("invalid label name %q", name)
+		}
+
+		value, n, err := readQuoted(s[eq+1:])
+		if err != nil {
+			return nil, "", err
+		}
+		labels[name] = model.LabelValue(value)
+
+		s = s[eq+1+n:]
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return nil, "", fmt.Errorf("invalid label set %q", s)
+		}
+	}
+}
+
+// readQuoted reads the escaped string between double quotes at the beginning
+// of s and returns it along with the number of bytes consumed
+func readQuoted(s string) (string, int, error) {
+	escaped := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			return unescape(s[1:i]), i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated label value %q", s)
+}
+
+// unescape resolves the \\, \n and \" escape sequences
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch {
+		case s[i] == 'n':
+			out = append(out, '\n')
+		case s[i] == '\\', s[i] == '"':
+			out = append(out, s[i])
+		default:
+			out = append(out, '\\', s[i])
+		}
+	}
+	return string(out)
+}
+
+// parseValue parses " value [timestamp]", OpenMetrics timestamps are
+// expressed in (possibly fractional) seconds
+func parseValue(s string) (model.SampleValue, model.Time, bool, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 1 || len(fields) > 2 {
+		return 0, 0, false, fmt.Errorf("invalid value %q", s)
+	}
+
+	value, err := parseFloat(fields[0])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(fields) == 1 {
+		return model.SampleValue(value), 0, false, nil
+	}
+
+	seconds, err := parseFloat(fields[1])
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, 0, false, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	return model.SampleValue(value), model.Time(math.Round(seconds * 1000)), true, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
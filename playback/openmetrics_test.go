@@ -0,0 +1,113 @@
+package playback
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const openMetricsBody = `# HELP http_requests Total requests, "quoted" and \\ escaped.
+# TYPE http_requests counter
+http_requests_total{code="200",path="/a\"b"} 10 1520430000.123 # {trace_id="abc"} 1 1520430000.1
+http_requests_created{code="200",path="/a\"b"} 1520000000
+# TYPE request_seconds histogram
+# UNIT request_seconds seconds
+request_seconds_bucket{le="0.5"} 3 # {trace_id="def"} 0.25
+request_seconds_bucket{le="+Inf"} 4
+request_seconds_count 4
+request_seconds_sum 2.5
+# TYPE temperature gauge
+temperature NaN
+# EOF
+`
+
+func parse(body string) (*Scrape, error) {
+	scrape := &Scrape{}
+	err := parseOpenMetrics(strings.NewReader(body), model.Time(42000), scrape)
+	return scrape, err
+}
+
+func TestParseOpenMetrics(t *testing.T) {
+	scrape, err := parse(openMetricsBody)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 7, len(scrape.Samples), "there should be exactly 7 samples")
+
+	total := scrape.Samples[0]
+	assert.Equal(t, model.LabelValue("http_requests_total"), total.Metric[model.MetricNameLabel], "the name should be parsed")
+	assert.Equal(t, model.LabelValue(`/a"b`), total.Metric["path"], "label values should be unescaped")
+	assert.Equal(t, model.SampleValue(10), total.Value, "the value should be parsed")
+	assert.Equal(t, model.Time(1520430000123), total.Timestamp, "timestamps are in seconds")
+
+	created := scrape.Samples[1]
+	assert.Equal(t, model.LabelValue("http_requests_created"), created.Metric[model.MetricNameLabel], "created series should be kept")
+	assert.Equal(t, model.Time(42000), created.Timestamp, "the default timestamp should be used")
+
+	assert.True(t, math.IsNaN(float64(scrape.Samples[6].Value)), "NaN should be parsed")
+	assert.Equal(t, model.LabelValue("+Inf"), scrape.Samples[3].Metric["le"], "le labels should be kept")
+}
+
+func TestParseOpenMetricsExemplars(t *testing.T) {
+	scrape, _ := parse(openMetricsBody)
+	assert.Equal(t, 2, len(scrape.Exemplars), "there should be exactly 2 exemplars")
+
+	exemplar := scrape.Exemplars[0]
+	assert.Equal(t, model.LabelSet{"trace_id": "abc"}, exemplar.Labels, "exemplar labels should be parsed")
+	assert.Equal(t, model.SampleValue(1), exemplar.Value, "exemplar value should be parsed")
+	assert.True(t, exemplar.HasTimestamp, "exemplar timestamp should be parsed")
+	assert.Equal(t, model.Time(1520430000100), exemplar.Timestamp, "exemplar timestamp should be parsed")
+	assert.Equal(t, scrape.Samples[0].Metric, exemplar.Metric, "exemplar should reference its series")
+
+	assert.False(t, scrape.Exemplars[1].HasTimestamp, "exemplar timestamp is optional")
+	assert.Equal(t, model.LabelValue("0.5"), scrape.Exemplars[1].Metric["le"], "exemplar should reference its bucket")
+}
+
+func TestParseOpenMetricsMetadata(t *testing.T) {
+	scrape, _ := parse(openMetricsBody)
+	assert.Equal(t, []*Metadata{
+		{MetricFamily: "http_requests", Type: "counter", Help: `Total requests, "quoted" and \ escaped.`},
+		{MetricFamily: "request_seconds", Type: "histogram", Unit: "seconds"},
+		{MetricFamily: "temperature", Type: "gauge"},
+	}, scrape.Metadata, "metadata should be parsed")
+}
+
+func TestParseOpenMetricsErrors(t *testing.T) {
+	scrape, err := parse("# TYPE foo gauge\nfoo 1\n")
+	assert.Equal(t, errMissingEOF, err, "# EOF is mandatory")
+	assert.Equal(t, 1, len(scrape.Samples), "samples before the error should be kept")
+
+	for _, body := range []string{
+		"# TYPE foo counter\nfoo 1\n# EOF\n",
+		"foo{bar=\"baz} 1\n# EOF\n",
+		"foo{bar=baz} 1\n# EOF\n",
+		"foo one\n# EOF\n",
+		"foo 1 2 3\n# EOF\n",
+		"foo 1 # {a=\"b\"}\n# EOF\n",
+		"\n# EOF\n",
+	} {
+		_, err := parse(body)
+		assert.NotEmpty(t, err, "%q should not be parsed", body)
+	}
+}
+
+func TestDecodeOpenMetrics(t *testing.T) {
+	frame := dumpFrame(http.StatusOK, "application/openmetrics-text; version=1.0.0; charset=utf-8", []byte(openMetricsBody))
+
+	scrape, err := Decode(frame, true)
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, 7, len(scrape.Samples), "there should be exactly 7 samples")
+	assert.Equal(t, 2, len(scrape.Exemplars), "exemplars should be kept")
+	assert.Equal(t, model.LabelValue("app"), scrape.Exemplars[0].Metric[JobLabel], "exemplars should get the target labels")
+	assert.Equal(t, "seconds", scrape.Metadata[1].Unit, "units should be kept")
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	scrape, _ := Decode(dumpFrame(http.StatusOK, "", []byte(textBody)), true)
+	assert.ElementsMatch(t, []*Metadata{
+		{MetricFamily: "http_requests_total", Type: "counter"},
+		{MetricFamily: "temperature", Type: "gauge"},
+	}, scrape.Metadata, "metadata should be extracted from text expositions")
+}
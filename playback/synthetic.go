@@ -0,0 +1,183 @@
+package playback
+
+import (
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// JobLabel is the label promplay uses for the frame Name
+	JobLabel = "job"
+	// URLLabel is the label promplay uses for the frame URI
+	URLLabel = "url"
+)
+
+// Names of the synthetic series Prometheus generates for every scrape
+const (
+	UpMetric                   = "up"
+	ScrapeDurationMetric       = "scrape_duration_seconds"
+	ScrapeSamplesScrapedMetric = "scrape_samples_scraped"
+	ScrapeSeriesAddedMetric    = "scrape_series_added"
+)
+
+// TargetMetric returns the labels identifying the target of a frame: the
+// job and url labels along with the labels recorded by promrec
+func TargetMetric(frame *cm.Frame) model.Metric {
+	metric := make(model.Metric, len(frame.Labels)+2)
+	for name, value := range frame.Labels {
+		metric[model.LabelName(name)] = model.LabelValue(value)
+	}
+	metric[JobLabel] = model.LabelValue(frame.NameString())
+	metric[URLLabel] = model.LabelValue(frame.URIString())
+	return metric
+}
+
+// Scrape is the outcome of a recorded scrape:
+//  - the StatusCode of the recorded response, 0 for failure frames
+//  - the Samples decoded from the response body
+//  - the native Histograms decoded from the response body (protobuf only)
+//  - the Exemplars attached to the samples (OpenMetrics only)
+//  - the Metadata of the exposed metric families
+type Scrape struct {
+	StatusCode int
+	Samples    model.Vector
+	Histograms []*HistogramSample
+	Exemplars  []*Exemplar
+	Metadata   []*Metadata
+}
+
+// Up tells whether the scrape succeeded, as Prometheus does only 2xx
+// responses are considered successful
+func (scrape *Scrape) Up() bool {
+	return scrape.StatusCode >= 200 && scrape.StatusCode < 300
+}
+
+// ClassicSamples returns the samples along with the classic representation
+// of the native histograms, for the outputs not supporting them
+func (scrape *Scrape) ClassicSamples() model.Vector {
+	samples := append(model.Vector{}, scrape.Samples...)
+	for _, h := range scrape.Histograms {
+		samples = append(samples, h.Classic...)
+	}
+	return samples
+}
+
+// setTimestamp overrides the timestamp of the samples and histograms,
+// exemplars keep their own timestamp
+func (scrape *Scrape) setTimestamp(timestamp model.Time) {
+	for _, s := range scrape.Samples {
+		s.Timestamp = timestamp
+	}
+	for _, h := range scrape.Histograms {
+		h.Timestamp = timestamp
+		for _, s := range h.Classic {
+			s.Timestamp = timestamp
+		}
+	}
+}
+
+// Shift moves the frame and the scrape decoded from it by offset, truncated
+// to the second as the frame timestamps are. Exemplars are only moved when
+// they carry a timestamp.
+func Shift(frame *cm.Frame, scrape *Scrape, offset time.Duration) {
+	seconds := int64(offset / time.Second)
+	if seconds == 0 {
+		return
+	}
+	frame.Header.Timestamp += seconds
+	delta := time.Duration(seconds) * time.Second
+	for _, s := range scrape.Samples {
+		s.Timestamp = s.Timestamp.Add(delta)
+	}
+	for _, h := range scrape.Histograms {
+		h.Timestamp = h.Timestamp.Add(delta)
+		for _, s := range h.Classic {
+			s.Timestamp = s.Timestamp.Add(delta)
+		}
+	}
+	for _, e := range scrape.Exemplars {
+		if e.HasTimestamp {
+			e.Timestamp = e.Timestamp.Add(delta)
+		}
+	}
+}
+
+// ScrapeSeries generates the series Prometheus attaches to every scrape:
+// up, scrape_duration_seconds, scrape_samples_scraped and
+// scrape_series_added. It remembers the series of the last scrape of every
+// target in order to count the added ones.
+type ScrapeSeries struct {
+	previous map[model.Fingerprint]map[model.Fingerprint]struct{}
+}
+
+// NewScrapeSeries generates a new ScrapeSeries
+func NewScrapeSeries() *ScrapeSeries {
+	return &ScrapeSeries{
+		previous: make(map[model.Fingerprint]map[model.Fingerprint]struct{}),
+	}
+}
+
+// Samples returns the synthetic samples of the frame. The scrape duration
+// is only generated when it has been recorded.
+func (ss *ScrapeSeries) Samples(frame *cm.Frame, scrape *Scrape) model.Vector {
+	target := TargetMetric(frame)
+	timestamp := model.TimeFromUnix(frame.Header.Timestamp)
+	sample := func(name string, value float64) *model.Sample {
+		metric := target.Clone()
+		metric[model.MetricNameLabel] = model.LabelValue(name)
+		return &model.Sample{
+			Metric:    metric,
+			Value:     model.SampleValue(value),
+			Timestamp: timestamp,
+		}
+	}
+
+	up, duration := 0.0, frame.Duration
+	if failure, err := frame.Failure(); err == nil {
+		duration = failure.Duration
+	} else if scrape.Up() {
+		up = 1
+	}
+
+	samples := model.Vector{sample(UpMetric, up)}
+	if duration > 0 {
+		samples = append(samples, sample(ScrapeDurationMetric, duration.Seconds()))
+	}
+	// as in Prometheus every native histogram counts as a single sample
+	metrics := make([]model.Metric, 0, len(scrape.Samples)+len(scrape.Histograms))
+	for _, s := range scrape.Samples {
+		metrics = append(metrics, s.Metric)
+	}
+	for _, h := range scrape.Histograms {
+		metrics = append(metrics, h.Metric)
+	}
+	samples = append(samples,
+		sample(ScrapeSamplesScrapedMetric, float64(len(metrics))),
+		sample(ScrapeSeriesAddedMetric, float64(ss.added(target.Fingerprint(), metrics))),
+	)
+	return samples
+}
+
+// added returns how many of the series were not part of the previous scrape
+// of the target
+func (ss *ScrapeSeries) added(target model.Fingerprint, metrics []model.Metric) int {
+	previous := ss.previous[target]
+	current := make(map[model.Fingerprint]struct{}, len(metrics))
+
+	added := 0
+	for _, metric := range metrics {
+		fp := metric.Fingerprint()
+		if _, ok := current[fp]; ok {
+			continue
+		}
+		if _, ok := previous[fp]; !ok {
+			added++
+		}
+		current[fp] = struct{}{}
+	}
+
+	ss.previous[target] = current
+	return added
+}
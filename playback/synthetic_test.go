@@ -0,0 +1,111 @@
+package playback
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleOf(name string, labels ...string) *model.Sample {
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(name)}
+	for i := 0; i+1 < len(labels); i += 2 {
+		metric[model.LabelName(labels[i])] = model.LabelValue(labels[i+1])
+	}
+	return &model.Sample{Metric: metric, Value: 1}
+}
+
+func valuesOf(samples model.Vector) map[string]float64 {
+	values := make(map[string]float64)
+	for _, s := range samples {
+		values[string(s.Metric[model.MetricNameLabel])] = float64(s.Value)
+	}
+	return values
+}
+
+func TestTargetMetric(t *testing.T) {
+	frame := cm.NewFrame("node", "http://10.0.0.1:9100/metrics", nil)
+	frame.Labels = map[string]string{"env": "prod", "job": "ignored"}
+
+	assert.Equal(t, model.Metric{
+		"job": "node",
+		"url": "http://10.0.0.1:9100/metrics",
+		"env": "prod",
+	}, TargetMetric(frame), "job and url should be taken from the frame")
+}
+
+func TestScrapeSeries(t *testing.T) {
+	ss := NewScrapeSeries()
+	frame := cm.NewFrame("node", "http://10.0.0.1:9100/metrics", nil)
+	frame.Labels = map[string]string{"env": "prod"}
+	frame.Duration = 1500 * time.Millisecond
+
+	samples := ss.Samples(frame, &Scrape{
+		StatusCode: http.StatusOK,
+		Samples:    model.Vector{sampleOf("foo"), sampleOf("bar")},
+	})
+	assert.Equal(t, map[string]float64{
+		UpMetric:                   1,
+		ScrapeDurationMetric:       1.5,
+		ScrapeSamplesScrapedMetric: 2,
+		ScrapeSeriesAddedMetric:    2,
+	}, valuesOf(samples), "the synthetic series should describe the scrape")
+
+	for _, s := range samples {
+		assert.Equal(t, model.LabelValue("node"), s.Metric[JobLabel], "the job label should be set")
+		assert.Equal(t, model.LabelValue("prod"), s.Metric["env"], "the target labels should be set")
+		assert.Equal(t, model.TimeFromUnix(frame.Header.Timestamp), s.Timestamp, "the frame timestamp should be used")
+	}
+
+	samples = ss.Samples(frame, &Scrape{
+		StatusCode: http.StatusOK,
+		Samples:    model.Vector{sampleOf("foo"), sampleOf("baz"), sampleOf("baz")},
+	})
+	assert.Equal(t, 1.0, valuesOf(samples)[ScrapeSeriesAddedMetric], "only new series should be counted as added")
+}
+
+func TestScrapeSeriesWithoutDuration(t *testing.T) {
+	frame := cm.NewFrame("node", "http://10.0.0.1:9100/metrics", nil)
+	samples := NewScrapeSeries().Samples(frame, &Scrape{StatusCode: http.StatusOK})
+
+	_, ok := valuesOf(samples)[ScrapeDurationMetric]
+	assert.False(t, ok, "the duration should only be generated when recorded")
+}
+
+func TestScrapeSeriesDown(t *testing.T) {
+	ss := NewScrapeSeries()
+
+	frame := cm.NewFrame("node", "http://10.0.0.1:9100/metrics", nil)
+	values := valuesOf(ss.Samples(frame, &Scrape{StatusCode: http.StatusInternalServerError}))
+	assert.Equal(t, 0.0, values[UpMetric], "non 2xx responses should be down")
+
+	failure := cm.NewFailureFrame("node", "http://10.0.0.1:9100/metrics", &cm.ScrapeFailure{
+		Kind:     cm.FailureTimeout,
+		Duration: 10 * time.Second,
+	})
+	values = valuesOf(ss.Samples(failure, &Scrape{}))
+	assert.Equal(t, 0.0, values[UpMetric], "failed scrapes should be down")
+	assert.Equal(t, 10.0, values[ScrapeDurationMetric], "the failure duration should be used")
+	assert.Equal(t, 0.0, values[ScrapeSamplesScrapedMetric], "failed scrapes have no samples")
+}
+
+func TestShift(t *testing.T) {
+	frame := cm.NewFrame("node", "http://10.0.0.1:9100/metrics", nil)
+	frame.Header.Timestamp = 1000
+	scrape := &Scrape{
+		Samples:    model.Vector{{Metric: model.Metric{"__name__": "a"}, Timestamp: 1000500}},
+		Histograms: []*HistogramSample{{Timestamp: 1000000, Classic: model.Vector{{Timestamp: 1000000}}}},
+		Exemplars:  []*Exemplar{{Timestamp: 999000, HasTimestamp: true}, {}},
+	}
+
+	Shift(frame, scrape, -time.Hour-500*time.Millisecond)
+	assert.Equal(t, int64(1000-3600), frame.Header.Timestamp, "the frame should be moved")
+	assert.Equal(t, model.Time(1000500-3600000), scrape.Samples[0].Timestamp, "the samples should be moved by whole seconds")
+	assert.Equal(t, model.Time(1000000-3600000), scrape.Histograms[0].Timestamp, "the histograms should be moved")
+	assert.Equal(t, model.Time(1000000-3600000), scrape.Histograms[0].Classic[0].Timestamp, "the classic histogram samples should be moved")
+	assert.Equal(t, model.Time(999000-3600000), scrape.Exemplars[0].Timestamp, "the exemplar timestamps should be moved")
+	assert.Equal(t, model.Time(0), scrape.Exemplars[1].Timestamp, "the exemplars without timestamp should be left alone")
+}
@@ -0,0 +1,149 @@
+// Package prompb holds the messages of the Prometheus remote write and remote
+// read protocols. They are wire compatible with the prompb package of
+// Prometheus 2.x/3.x, native histograms and exemplars included.
+package prompb
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/model"
+)
+
+// MetricType is the type of a MetricMetadata
+type MetricType int32
+
+// Metric types of the remote write metadata
+const (
+	MetricTypeUnknown        MetricType = 0
+	MetricTypeCounter        MetricType = 1
+	MetricTypeGauge          MetricType = 2
+	MetricTypeHistogram      MetricType = 3
+	MetricTypeGaugeHistogram MetricType = 4
+	MetricTypeSummary        MetricType = 5
+	MetricTypeInfo           MetricType = 6
+	MetricTypeStateset       MetricType = 7
+)
+
+// MetricTypes maps the OpenMetrics type names to the metadata types
+var MetricTypes = map[string]MetricType{
+	"unknown":        MetricTypeUnknown,
+	"untyped":        MetricTypeUnknown,
+	"counter":        MetricTypeCounter,
+	"gauge":          MetricTypeGauge,
+	"histogram":      MetricTypeHistogram,
+	"gaugehistogram": MetricTypeGaugeHistogram,
+	"summary":        MetricTypeSummary,
+	"info":           MetricTypeInfo,
+	"stateset":       MetricTypeStateset,
+}
+
+// MetricMetadata is the metadata of a metric family
+type MetricMetadata struct {
+	Type             MetricType `protobuf:"varint,1,opt,name=type,proto3" json:"type,omitempty"`
+	MetricFamilyName string     `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3" json:"metric_family_name,omitempty"`
+	Help             string     `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Unit             string     `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return proto.CompactTextString(m) }
+func (*MetricMetadata) ProtoMessage()    {}
+
+// Sample is a float sample, the timestamp is in milliseconds
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+// Exemplar is an exemplar of a series, the timestamp is in milliseconds
+type Exemplar struct {
+	Labels    []*Label `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Value     float64  `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64    `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Exemplar) Reset()         { *m = Exemplar{} }
+func (m *Exemplar) String() string { return proto.CompactTextString(m) }
+func (*Exemplar) ProtoMessage()    {}
+
+// Histogram is a native histogram sample. The count and zero count are
+// either integers, along with delta encoded bucket counts, or floats, along
+// with absolute bucket counts: the pointer fields stand for the oneof fields
+// of the Prometheus message, only one of each pair has to be set.
+type Histogram struct {
+	CountInt       *uint64       `protobuf:"varint,1,opt,name=count_int,json=countInt" json:"count_int,omitempty"`
+	CountFloat     *float64      `protobuf:"fixed64,2,opt,name=count_float,json=countFloat" json:"count_float,omitempty"`
+	Sum            float64       `protobuf:"fixed64,3,opt,name=sum,proto3" json:"sum,omitempty"`
+	Schema         int32         `protobuf:"zigzag32,4,opt,name=schema,proto3" json:"schema,omitempty"`
+	ZeroThreshold  float64       `protobuf:"fixed64,5,opt,name=zero_threshold,json=zeroThreshold,proto3" json:"zero_threshold,omitempty"`
+	ZeroCountInt   *uint64       `protobuf:"varint,6,opt,name=zero_count_int,json=zeroCountInt" json:"zero_count_int,omitempty"`
+	ZeroCountFloat *float64      `protobuf:"fixed64,7,opt,name=zero_count_float,json=zeroCountFloat" json:"zero_count_float,omitempty"`
+	NegativeSpans  []*BucketSpan `protobuf:"bytes,8,rep,name=negative_spans,json=negativeSpans,proto3" json:"negative_spans,omitempty"`
+	NegativeDeltas []int64       `protobuf:"zigzag64,9,rep,packed,name=negative_deltas,json=negativeDeltas,proto3" json:"negative_deltas,omitempty"`
+	NegativeCounts []float64     `protobuf:"fixed64,10,rep,packed,name=negative_counts,json=negativeCounts,proto3" json:"negative_counts,omitempty"`
+	PositiveSpans  []*BucketSpan `protobuf:"bytes,11,rep,name=positive_spans,json=positiveSpans,proto3" json:"positive_spans,omitempty"`
+	PositiveDeltas []int64       `protobuf:"zigzag64,12,rep,packed,name=positive_deltas,json=positiveDeltas,proto3" json:"positive_deltas,omitempty"`
+	PositiveCounts []float64     `protobuf:"fixed64,13,rep,packed,name=positive_counts,json=positiveCounts,proto3" json:"positive_counts,omitempty"`
+	ResetHint      int32         `protobuf:"varint,14,opt,name=reset_hint,json=resetHint,proto3" json:"reset_hint,omitempty"`
+	Timestamp      int64         `protobuf:"varint,15,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Histogram) Reset()         { *m = Histogram{} }
+func (m *Histogram) String() string { return proto.CompactTextString(m) }
+func (*Histogram) ProtoMessage()    {}
+
+// BucketSpan is a run of consecutive buckets of a native histogram
+type BucketSpan struct {
+	Offset int32  `protobuf:"zigzag32,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length uint32 `protobuf:"varint,2,opt,name=length,proto3" json:"length,omitempty"`
+}
+
+func (m *BucketSpan) Reset()         { *m = BucketSpan{} }
+func (m *BucketSpan) String() string { return proto.CompactTextString(m) }
+func (*BucketSpan) ProtoMessage()    {}
+
+// TimeSeries is a series along with its samples, exemplars and histograms
+type TimeSeries struct {
+	Labels     []*Label     `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Samples    []*Sample    `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+	Exemplars  []*Exemplar  `protobuf:"bytes,3,rep,name=exemplars,proto3" json:"exemplars,omitempty"`
+	Histograms []*Histogram `protobuf:"bytes,4,rep,name=histograms,proto3" json:"histograms,omitempty"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+// Label is a label pair
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+// LabelsFromMetric converts the metric into labels sorted by name
+func LabelsFromMetric(metric model.Metric) []*Label {
+	labels := make([]*Label, 0, len(metric))
+	for name, value := range metric {
+		labels = append(labels, &Label{Name: string(name), Value: string(value)})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+// MetricFromLabels converts the labels into a metric
+func MetricFromLabels(labels []*Label) model.Metric {
+	metric := make(model.Metric, len(labels))
+	for _, l := range labels {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric
+}
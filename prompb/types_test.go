@@ -0,0 +1,42 @@
+package prompb
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleWireFormat(t *testing.T) {
+	data, err := proto.Marshal(&Sample{Value: 1, Timestamp: 2})
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, []byte{
+		0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f, // value: fixed64 field 1
+		0x10, 0x02, // timestamp: varint field 2
+	}, data, "samples should be encoded as the Prometheus ones")
+}
+
+func TestBucketSpanWireFormat(t *testing.T) {
+	data, err := proto.Marshal(&BucketSpan{Offset: -1, Length: 2})
+	assert.Empty(t, err, "should not be any error")
+	assert.Equal(t, []byte{0x08, 0x01, 0x10, 0x02}, data, "offsets should be zigzag encoded")
+}
+
+func TestHistogramExplicitPresence(t *testing.T) {
+	zero := uint64(0)
+	data, err := proto.Marshal(&Histogram{CountInt: &zero, ZeroCountInt: &zero})
+	assert.Empty(t, err, "should not be any error")
+
+	decoded := &Histogram{}
+	assert.Empty(t, proto.Unmarshal(data, decoded), "should not be any error")
+	assert.NotNil(t, decoded.CountInt, "a zero count should still be sent")
+	assert.Nil(t, decoded.CountFloat, "the other oneof field should not be set")
+}
+
+func TestLabelsFromMetric(t *testing.T) {
+	metric := model.Metric{"job": "app", "__name__": "up", "instance": "a:80"}
+	labels := LabelsFromMetric(metric)
+	assert.Equal(t, []*Label{{"__name__", "up"}, {"instance", "a:80"}, {"job", "app"}}, labels, "labels should be sorted by name")
+	assert.Equal(t, metric, MetricFromLabels(labels), "the conversion should round trip")
+}
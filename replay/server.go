@@ -0,0 +1,166 @@
+// Package replay serves recorded frames as live /metrics endpoints, so that
+// a running Prometheus (or any other scraper) ingests a recording as if the
+// recorded services were up.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/sirupsen/logrus"
+)
+
+// PathPrefix is the path of the endpoints, followed by the service Name
+const PathPrefix = "/metrics/"
+
+// Options configures the Server:
+//  - the Speed multiplier of the replay, 1 replays the frames at the pace
+//    they were recorded
+//  - Loop to start over from the first frame once the last one is served
+type Options struct {
+	Speed float64
+	Loop  bool
+}
+
+// Server plays the frames in sequence, each endpoint serving the last frame
+// played of its service: the recorded status, Content-Type and body, or a
+// 503 for the failed scrapes
+type Server struct {
+	options Options
+	open    func() <-chan cm.Frame
+	mtx     sync.RWMutex
+	current map[string]*response
+}
+
+// response is the recorded response of a frame
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// NewServer generates a new Server playing the frames returned by open,
+// called again on every loop
+func NewServer(open func() <-chan cm.Frame, options Options) *Server {
+	if options.Speed <= 0 {
+		options.Speed = 1
+	}
+	return &Server{
+		options: options,
+		open:    open,
+		current: make(map[string]*response),
+	}
+}
+
+// Run plays the frames until the last one, or forever when looping, unless
+// the context is canceled
+func (s *Server) Run(ctx context.Context) error {
+	for loop := 1; ; loop++ {
+		logrus.Infof("Replaying the recordings, loop %d", loop)
+		played := 0
+		start := time.Now()
+		var first int64
+		for frame := range s.open() {
+			if played == 0 {
+				first = frame.Header.Timestamp
+			}
+			elapsed := time.Duration(float64(time.Duration(frame.Header.Timestamp-first)*time.Second) / s.options.Speed)
+			if wait := time.Until(start.Add(elapsed)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+
+			s.play(&frame)
+			played++
+		}
+		if !s.options.Loop || played == 0 {
+			logrus.Infof("Replay completed, %d frames played", played)
+			return nil
+		}
+	}
+}
+
+// play makes the frame the one served by the endpoint of its service
+func (s *Server) play(frame *cm.Frame) {
+	resp, err := parseFrame(frame)
+	if err != nil {
+		logrus.Errorf("Errors occured while reading frame %s, MESSAGE: %v", frame.NameString(), err)
+		return
+	}
+	logrus.Debugf("Serving the frame of %s recorded at %v", frame.NameString(), time.Unix(frame.Header.Timestamp, 0))
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.current[frame.NameString()] = resp
+}
+
+func parseFrame(frame *cm.Frame) (*response, error) {
+	if frame.Header.Type == cm.FailureFrame {
+		failure, err := frame.Failure()
+		if err != nil {
+			return nil, err
+		}
+		return &response{
+			status:      http.StatusServiceUnavailable,
+			contentType: "text/plain; charset=utf-8",
+			body:        []byte(fmt.Sprintf("scrape failed (%s): %s\n", failure.Kind, failure.Message)),
+		}, nil
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(frame.Data)), &http.Request{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		status:      resp.StatusCode,
+		contentType: resp.Header.Get("Content-Type"),
+		body:        body,
+	}, nil
+}
+
+// ServeHTTP serves the endpoints under PathPrefix, and their list at /
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if r.URL.Path == "/" {
+		names := make([]string, 0, len(s.current))
+		for name := range s.current {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, name := range names {
+			fmt.Fprintln(w, PathPrefix+name)
+		}
+		return
+	}
+
+	resp, ok := s.current[strings.TrimPrefix(r.URL.Path, PathPrefix)]
+	if !ok || !strings.HasPrefix(r.URL.Path, PathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
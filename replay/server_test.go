@@ -0,0 +1,85 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"testing"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// dumpFrame generates a scrape frame as recorded by promrec
+func dumpFrame(name string, timestamp int64, body string) cm.Frame {
+	response := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; version=0.0.4"}},
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+	}
+	dump, _ := httputil.DumpResponse(response, true)
+	frame := cm.NewFrame(name, "http://10.0.0.1:8080/metrics", dump)
+	frame.Header.Timestamp = timestamp
+	return *frame
+}
+
+func frames(frames ...cm.Frame) func() <-chan cm.Frame {
+	return func() <-chan cm.Frame {
+		ch := make(chan cm.Frame, len(frames))
+		for _, frame := range frames {
+			ch <- frame
+		}
+		close(ch)
+		return ch
+	}
+}
+
+func get(s *Server, path string) (int, string, string) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code, w.Header().Get("Content-Type"), w.Body.String()
+}
+
+func TestServerReplay(t *testing.T) {
+	failure := cm.NewFailureFrame("db", "http://10.0.0.2:8080/metrics", &cm.ScrapeFailure{Kind: "timeout", Message: "deadline exceeded"})
+	failure.Header.Timestamp = 100
+	s := NewServer(frames(dumpFrame("app", 100, "up 1\n"), *failure, dumpFrame("app", 101, "up 2\n")), Options{Speed: 10})
+
+	start := time.Now()
+	assert.Empty(t, s.Run(context.Background()), "should not be any error")
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "the frames should be played at the given speed")
+
+	status, contentType, body := get(s, "/metrics/app")
+	assert.Equal(t, http.StatusOK, status, "the recorded status should be served")
+	assert.Equal(t, "text/plain; version=0.0.4", contentType, "the recorded Content-Type should be served")
+	assert.Equal(t, "up 2\n", body, "the last frame played should be served")
+
+	status, _, _ = get(s, "/metrics/db")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "failed scrapes should be served as errors")
+	status, _, _ = get(s, "/metrics/web")
+	assert.Equal(t, http.StatusNotFound, status, "unknown services should not be found")
+	_, _, body = get(s, "/")
+	assert.Equal(t, "/metrics/app\n/metrics/db\n", body, "the endpoints should be listed")
+}
+
+func TestServerLoop(t *testing.T) {
+	opened := 0
+	open := frames(dumpFrame("app", 100, "up 1\n"), dumpFrame("app", 101, "up 2\n"))
+	s := NewServer(func() <-chan cm.Frame {
+		opened++
+		return open()
+	}, Options{Speed: 20, Loop: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Run(ctx), "the replay should loop until canceled")
+	assert.True(t, opened >= 2, "the frames should be replayed from the first one")
+}
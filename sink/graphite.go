@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// GraphiteOptions configures the Graphite sink:
+//  - the Template of the paths, where $name (or ${name}) expands to the
+//    value of the label name and $__name__ to the metric name. Without
+//    Template the paths are the metric name followed by the name and value
+//    of every label (eg. up.job.app.url.http:__a_metrics).
+//  - Tagged to write the labels not used by the Template as Graphite tags
+//    (eg. up;job=app;url=http://a/metrics)
+//  - the TCP Address of carbon, along with the Timeout of the connection;
+//    without Address the lines are written to the Output file
+//  - the MaxRetries of the batches failing to be written to carbon, every
+//    retry reconnecting after an exponential backoff from MinBackoff to
+//    MaxBackoff
+type GraphiteOptions struct {
+	Template   string
+	Tagged     bool
+	Output     string
+	Address    string
+	Timeout    time.Duration
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Graphite writes the samples as Graphite plaintext lines, timestamps in
+// seconds
+type Graphite struct {
+	options GraphiteOptions
+	out     io.WriteCloser
+	writer  *bufio.Writer
+	conn    net.Conn
+}
+
+// NewGraphite generates a new Graphite sink, connecting to carbon or
+// creating the output file
+func NewGraphite(options GraphiteOptions) (*Graphite, error) {
+	g := &Graphite{options: options}
+	if options.Address != "" {
+		if err := g.dial(); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	out, err := createOutput(options.Output)
+	if err != nil {
+		return nil, err
+	}
+	g.out = out
+	g.writer = bufio.NewWriter(out)
+	return g, nil
+}
+
+// Append writes a line for every sample. NaN and infinite values are
+// skipped.
+func (g *Graphite) Append(batch *Batch) error {
+	var lines bytes.Buffer
+	skipped := 0
+	for _, s := range batch.Samples {
+		value := float64(s.Value)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			skipped++
+			continue
+		}
+
+		fmt.Fprintf(&lines, "%s %s %d\n", g.path(s.Metric), strconv.FormatFloat(value, 'g', -1, 64), s.Timestamp.Unix())
+	}
+	if skipped > 0 {
+		logrus.Infof("%d NaN or infinite samples skipped", skipped)
+	}
+	if g.writer != nil {
+		_, err := g.writer.Write(lines.Bytes())
+		return err
+	}
+	return g.send(lines.Bytes())
+}
+
+// send writes the lines of a batch to carbon. When the write fails the
+// connection is dialed again and the whole batch written again, so carbon
+// may receive some lines twice (overwriting the same points).
+func (g *Graphite) send(lines []byte) error {
+	backoff := g.options.MinBackoff
+	for try := 0; ; try++ {
+		err := g.write(lines)
+		if err == nil {
+			return nil
+		}
+		if try >= g.options.MaxRetries {
+			return fmt.Errorf("writing to carbon failed after %d retries: %v", try, err)
+		}
+
+		logrus.Warnf("Writing to carbon failed, reconnecting in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > g.options.MaxBackoff {
+			backoff = g.options.MaxBackoff
+		}
+	}
+}
+
+// write writes the lines on the connection, dialing it first if the
+// previous write failed
+func (g *Graphite) write(lines []byte) error {
+	if g.conn == nil {
+		if err := g.dial(); err != nil {
+			return err
+		}
+	}
+	if g.options.Timeout > 0 {
+		g.conn.SetWriteDeadline(time.Now().Add(g.options.Timeout))
+	}
+	if _, err := g.conn.Write(lines); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+// dial connects to carbon
+func (g *Graphite) dial() error {
+	conn, err := net.DialTimeout("tcp", g.options.Address, g.options.Timeout)
+	if err != nil {
+		return err
+	}
+	g.conn = conn
+	return nil
+}
+
+// Flush writes the lines buffered for the output file, the batches being
+// sent to carbon as soon as they are appended
+func (g *Graphite) Flush() error {
+	if g.writer != nil {
+		return g.writer.Flush()
+	}
+	return nil
+}
+
+// Close flushes the buffered lines and closes the file or the connection,
+// if any is left after the last failed write
+func (g *Graphite) Close() error {
+	if g.options.Address != "" {
+		if g.conn == nil {
+			return nil
+		}
+		return g.conn.Close()
+	}
+	err := g.Flush()
+	if cerr := g.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Capabilities of Graphite: float samples only
+func (g *Graphite) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// path returns the path of the metric, along with the tags when Tagged
+func (g *Graphite) path(metric model.Metric) string {
+	used := map[model.LabelName]bool{model.MetricNameLabel: true}
+	var path string
+	if g.options.Template != "" {
+		path = os.Expand(g.options.Template, func(name string) string {
+			used[model.LabelName(name)] = true
+			return graphiteNode(string(metric[model.LabelName(name)]))
+		})
+	} else {
+		path = string(metric[model.MetricNameLabel])
+	}
+
+	names := make(model.LabelNames, 0, len(metric))
+	for name, value := range metric {
+		if !used[name] && value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(names)
+
+	for _, name := range names {
+		value := string(metric[name])
+		switch {
+		case g.options.Tagged:
+			path += ";" + string(name) + "=" + tagEscaper.Replace(value)
+		case g.options.Template == "":
+			path += "." + string(name) + "." + graphiteNode(value)
+		}
+	}
+	return path
+}
+
+var (
+	invalidNode = regexp.MustCompile(`[^a-zA-Z0-9_:\-]`)
+	tagEscaper  = strings.NewReplacer(";", "_", "~", "_", " ", "_")
+)
+
+// graphiteNode replaces the characters not allowed in a path node with _
+func graphiteNode(value string) string {
+	return invalidNode.ReplaceAllString(value, "_")
+}
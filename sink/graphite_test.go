@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func graphiteBatch() *Batch {
+	return &Batch{Samples: model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app", "url": "http://a/metrics"}, Value: 1, Timestamp: 1500},
+		{Metric: model.Metric{"__name__": "up", "job": "db", "zone": ""}, Value: model.SampleValue(math.Inf(1)), Timestamp: 1500},
+	}}
+}
+
+func writeGraphite(t *testing.T, options GraphiteOptions) string {
+	return writeSink(t, func(output string) (Sink, error) {
+		options.Output = output
+		return NewGraphite(options)
+	}, graphiteBatch())
+}
+
+func TestGraphitePaths(t *testing.T) {
+	assert.Equal(t, "up.job.app.url.http:__a_metrics 1 1\n", writeGraphite(t, GraphiteOptions{}),
+		"the labels should be flattened into the path")
+	assert.Equal(t, "prom.app.up 1 1\n", writeGraphite(t, GraphiteOptions{Template: "prom.${job}.$__name__"}),
+		"the path should be expanded from the template")
+}
+
+func TestGraphiteTagged(t *testing.T) {
+	assert.Equal(t, "prom.up;job=app;url=http://a/metrics 1 1\n", writeGraphite(t, GraphiteOptions{Template: "prom.$__name__", Tagged: true}),
+		"the labels not in the template should be tags")
+}
+
+func TestGraphiteTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Empty(t, err, "should not be any error")
+	defer listener.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	graphite, err := NewGraphite(GraphiteOptions{Address: listener.Addr().String(), Timeout: time.Second})
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, graphite.Append(graphiteBatch()), "should not be any error")
+	assert.Empty(t, graphite.Close(), "should not be any error")
+	assert.Equal(t, "up.job.app.url.http:__a_metrics 1 1\n", <-received, "the lines should be sent to carbon")
+}
+
+func TestGraphiteReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Empty(t, err, "should not be any error")
+	defer listener.Close()
+	received := make(chan string)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				data, _ := ioutil.ReadAll(conn)
+				received <- string(data)
+			}()
+		}
+	}()
+
+	graphite, err := NewGraphite(GraphiteOptions{Address: listener.Addr().String(), Timeout: time.Second, MaxRetries: 2})
+	assert.Empty(t, err, "should not be any error")
+	graphite.conn.Close()
+	assert.Empty(t, graphite.Append(graphiteBatch()), "the batch should be written on a new connection")
+	assert.Empty(t, graphite.Close(), "should not be any error")
+	assert.Equal(t, "up.job.app.url.http:__a_metrics 1 1\n", <-received+<-received, "the lines should be sent once, on the new connection")
+}
+
+func TestGraphiteRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Empty(t, err, "should not be any error")
+	graphite, err := NewGraphite(GraphiteOptions{Address: listener.Addr().String(), Timeout: time.Second, MaxRetries: 2})
+	assert.Empty(t, err, "should not be any error")
+
+	listener.Close()
+	graphite.conn.Close()
+	err = graphite.Append(graphiteBatch())
+	assert.Contains(t, err.Error(), "after 2 retries", "the retries should be bounded")
+	assert.Empty(t, graphite.Close(), "closing after the failed retries should not fail")
+}
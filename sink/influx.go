@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// InfluxOptions configures the Influx sink:
+//  - the Measurement and Field templates, where $name (or ${name}) expands to
+//    the value of the label name and $__name__ to the metric name. The labels
+//    used by the templates are not written as tags.
+//  - the URL of the write API (eg. http://influx:8086/write?db=prom or
+//    http://influx:8086/api/v2/write?org=o&bucket=b) along with the extra
+//    Headers (eg. Authorization), the Timeout and the BatchSize of the
+//    requests; without URL the lines are written to the Output file
+type InfluxOptions struct {
+	Measurement string
+	Field       string
+	Output      string
+	URL         string
+	Headers     map[string]string
+	Timeout     time.Duration
+	BatchSize   int
+}
+
+// Influx writes the samples as InfluxDB line protocol. The samples sharing
+// measurement, tags and timestamp within a batch are written as the fields
+// of a single point.
+type Influx struct {
+	options InfluxOptions
+	client  *http.Client
+	out     io.WriteCloser
+	writer  *bufio.Writer
+	buffer  bytes.Buffer
+	lines   int
+}
+
+// NewInflux generates a new Influx sink, creating the output file when no
+// URL is given
+func NewInflux(options InfluxOptions) (*Influx, error) {
+	influx := &Influx{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+	}
+	if options.URL == "" {
+		out, err := createOutput(options.Output)
+		if err != nil {
+			return nil, err
+		}
+		influx.out = out
+		influx.writer = bufio.NewWriter(out)
+	}
+	return influx, nil
+}
+
+// influxPoint is a line of the line protocol being built
+type influxPoint struct {
+	key    string
+	fields map[string]float64
+	time   model.Time
+}
+
+// Append writes the samples, or posts them as soon as BatchSize lines are
+// buffered. NaN and infinite values cannot be stored by InfluxDB and are
+// skipped, as are the samples whose measurement or field template expands
+// to an empty string (eg. using a label the series lacks), which InfluxDB
+// would reject along with the whole request.
+func (i *Influx) Append(batch *Batch) error {
+	skipped, unnamed := 0, 0
+	points := make([]*influxPoint, 0)
+	index := make(map[string]*influxPoint)
+	for _, s := range batch.Samples {
+		value := float64(s.Value)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			skipped++
+			continue
+		}
+
+		key, field, ok := i.mapSample(s.Metric)
+		if !ok {
+			unnamed++
+			continue
+		}
+		id := key + " " + strconv.FormatInt(int64(s.Timestamp), 10)
+		point, ok := index[id]
+		if !ok {
+			point = &influxPoint{key: key, fields: make(map[string]float64), time: s.Timestamp}
+			index[id] = point
+			points = append(points, point)
+		}
+		point.fields[field] = value
+	}
+	if skipped > 0 {
+		logrus.Infof("%d NaN or infinite samples skipped", skipped)
+	}
+	if unnamed > 0 {
+		logrus.Infof("%d samples skipped, their measurement or field expands to an empty string", unnamed)
+	}
+
+	for _, point := range points {
+		line := formatPoint(point)
+		if i.writer != nil {
+			if _, err := i.writer.WriteString(line); err != nil {
+				return err
+			}
+			continue
+		}
+		i.buffer.WriteString(line)
+		if i.lines++; i.lines >= i.options.BatchSize {
+			if err := i.post(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to the file or posts them
+func (i *Influx) Flush() error {
+	if i.writer != nil {
+		return i.writer.Flush()
+	}
+	return i.post()
+}
+
+// Close flushes the buffered lines and closes the file
+func (i *Influx) Close() error {
+	err := i.Flush()
+	if i.out != nil {
+		if cerr := i.out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Capabilities of InfluxDB: float samples only
+func (i *Influx) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// mapSample returns the measurement along with the tags, already escaped,
+// and the field of the sample; false when the measurement or the field is
+// empty
+func (i *Influx) mapSample(metric model.Metric) (string, string, bool) {
+	used := make(map[model.LabelName]bool)
+	expand := func(template string) string {
+		return os.Expand(template, func(name string) string {
+			used[model.LabelName(name)] = true
+			return string(metric[model.LabelName(name)])
+		})
+	}
+	measurement := expand(i.options.Measurement)
+	field := expand(i.options.Field)
+	if measurement == "" || field == "" {
+		return "", "", false
+	}
+
+	tags := make([]string, 0, len(metric))
+	for name, value := range metric {
+		if used[name] || name == model.MetricNameLabel || value == "" {
+			continue
+		}
+		tags = append(tags, influxEscaper.Replace(string(name))+"="+influxEscaper.Replace(string(value)))
+	}
+	sort.Strings(tags)
+
+	key := measurementEscaper.Replace(measurement)
+	if len(tags) > 0 {
+		key += "," + strings.Join(tags, ",")
+	}
+	return key, field, true
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxEscaper      = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// formatPoint formats the point, fields sorted by name and timestamp in
+// nanoseconds
+func formatPoint(point *influxPoint) string {
+	names := make([]string, 0, len(point.fields))
+	for name := range point.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, influxEscaper.Replace(name)+"="+strconv.FormatFloat(point.fields[name], 'g', -1, 64))
+	}
+	return fmt.Sprintf("%s %s %d\n", point.key, strings.Join(fields, ","), point.time.UnixNano())
+}
+
+// post posts the buffered lines to the write API
+func (i *Influx) post() error {
+	if i.buffer.Len() == 0 {
+		return nil
+	}
+	if err := post(i.client, i.options.URL, i.options.Headers, "text/plain; charset=utf-8", i.buffer.Bytes()); err != nil {
+		return err
+	}
+	i.buffer.Reset()
+	i.lines = 0
+	return nil
+}
@@ -0,0 +1,94 @@
+package sink
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func influxBatch() *Batch {
+	return &Batch{Samples: model.Vector{
+		{Metric: model.Metric{"__name__": "cpu_seconds", "job": "app", "mode": "idle"}, Value: 10, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "memory_bytes", "job": "app", "mode": "idle"}, Value: 2.5, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "my app,eu"}, Value: model.SampleValue(math.NaN()), Timestamp: 1000},
+	}}
+}
+
+func writeInflux(t *testing.T, options InfluxOptions) string {
+	return writeSink(t, func(output string) (Sink, error) {
+		options.Output = output
+		return NewInflux(options)
+	}, influxBatch())
+}
+
+func TestInfluxMetricMeasurement(t *testing.T) {
+	lines := writeInflux(t, InfluxOptions{Measurement: "$__name__", Field: "value"})
+	assert.Equal(t, "cpu_seconds,job=app,mode=idle value=10 1000000000\n"+
+		"memory_bytes,job=app,mode=idle value=2.5 1000000000\n", lines, "every metric should be a measurement")
+}
+
+func TestInfluxMetricField(t *testing.T) {
+	lines := writeInflux(t, InfluxOptions{Measurement: "${job}", Field: "$__name__"})
+	assert.Equal(t, "app,mode=idle cpu_seconds=10,memory_bytes=2.5 1000000000\n", lines,
+		"the samples sharing measurement, tags and timestamp should be fields of one point")
+}
+
+func TestInfluxEscaping(t *testing.T) {
+	metric := model.Metric{"__name__": "up", "job": "my app,eu", "path": "a=b"}
+	influx := &Influx{options: InfluxOptions{Measurement: "prom metrics", Field: "$__name__"}}
+	key, field, ok := influx.mapSample(metric)
+	assert.True(t, ok, "the sample should be mapped")
+	assert.Equal(t, `prom\ metrics,job=my\ app\,eu,path=a\=b`, key, "measurement and tags should be escaped")
+	assert.Equal(t, "up", field, "the field should be expanded")
+}
+
+func TestInfluxEmptyTemplate(t *testing.T) {
+	lines := writeInflux(t, InfluxOptions{Measurement: "${mode}", Field: "$__name__"})
+	assert.Equal(t, "idle,job=app cpu_seconds=10,memory_bytes=2.5 1000000000\n", lines,
+		"the samples whose measurement expands to an empty string should be skipped")
+
+	influx := &Influx{options: InfluxOptions{Measurement: "$__name__", Field: "${field}"}}
+	_, _, ok := influx.mapSample(model.Metric{"__name__": "up"})
+	assert.False(t, ok, "the samples whose field expands to an empty string should be skipped")
+}
+
+func TestInfluxHTTP(t *testing.T) {
+	var bodies []string
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	influx, err := NewInflux(InfluxOptions{
+		Measurement: "$__name__",
+		Field:       "value",
+		URL:         server.URL + "/api/v2/write?org=o&bucket=b",
+		Headers:     map[string]string{"Authorization": "Token secret"},
+		BatchSize:   1,
+	})
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, influx.Append(influxBatch()), "should not be any error")
+	assert.Empty(t, influx.Close(), "should not be any error")
+	assert.Equal(t, 2, len(bodies), "a request should be sent for every batch")
+	assert.Equal(t, "Token secret", auth, "the extra headers should be sent")
+}
+
+func TestInfluxHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	influx, _ := NewInflux(InfluxOptions{Measurement: "$__name__", Field: "value", URL: server.URL, BatchSize: 100})
+	influx.Append(influxBatch())
+	assert.NotEmpty(t, influx.Flush(), "write errors should be returned")
+}
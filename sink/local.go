@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/local"
+	"github.com/sirupsen/logrus"
+)
+
+// Local writes the samples into a Prometheus 1.x local storage
+type Local struct {
+	storage *local.MemorySeriesStorage
+}
+
+// NewLocal starts the local storage configured by the options
+func NewLocal(options *local.MemorySeriesStorageOptions) (*Local, error) {
+	storage := local.NewMemorySeriesStorage(options)
+
+	logrus.Infoln("Starting the storage engine")
+	if err := storage.Start(); err != nil {
+		return nil, err
+	}
+	return &Local{storage: storage}, nil
+}
+
+// Append appends the samples, waiting for the storage whenever it needs
+// throttling
+func (l *Local) Append(batch *Batch) error {
+	for l.storage.NeedsThrottling() {
+		logrus.Debugln("THROTTLING: Waiting 100ms for appender to be ready for more data")
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	for _, s := range model.Samples(batch.Samples) {
+		if err := l.storage.Append(s); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"sample": s,
+				"error":  err,
+			}).Error("Sample discarded")
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, the storage persists its chunks on its own
+func (l *Local) Flush() error {
+	return nil
+}
+
+// Close stops the storage, persisting the chunks in memory
+func (l *Local) Close() error {
+	return l.storage.Stop()
+}
+
+// Capabilities of the local storage: float samples only, native histograms
+// are written as classic histograms
+func (l *Local) Capabilities() Capabilities {
+	return Capabilities{}
+}
@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// OpenMetrics writes the samples into a timestamped OpenMetrics text file,
+// as expected by promtool tsdb create-blocks-from openmetrics. Since the
+// samples of a metric family have to be contiguous, and the ones of a series
+// sorted by timestamp, all the samples are kept in memory and written on
+// Close.
+type OpenMetrics struct {
+	path     string
+	families map[model.LabelValue]map[model.Fingerprint]*series
+}
+
+// series is a series along with its samples
+type series struct {
+	metric  model.Metric
+	samples []model.SamplePair
+}
+
+// NewOpenMetrics generates a new OpenMetrics sink writing into path, "-"
+// stands for the standard output
+func NewOpenMetrics(path string) *OpenMetrics {
+	return &OpenMetrics{
+		path:     path,
+		families: make(map[model.LabelValue]map[model.Fingerprint]*series),
+	}
+}
+
+// Append buffers the samples
+func (om *OpenMetrics) Append(batch *Batch) error {
+	for _, s := range batch.Samples {
+		name := s.Metric[model.MetricNameLabel]
+		family, ok := om.families[name]
+		if !ok {
+			family = make(map[model.Fingerprint]*series)
+			om.families[name] = family
+		}
+		fp := s.Metric.Fingerprint()
+		ss, ok := family[fp]
+		if !ok {
+			ss = &series{metric: s.Metric}
+			family[fp] = ss
+		}
+		ss.samples = append(ss.samples, model.SamplePair{Timestamp: s.Timestamp, Value: s.Value})
+	}
+	return nil
+}
+
+// Flush does nothing, the file is written on Close
+func (om *OpenMetrics) Flush() error {
+	return nil
+}
+
+// Close writes the file: families sorted by name, series sorted by labels
+// and samples sorted by timestamp, keeping the first sample of duplicated
+// timestamps. Every metric name is written as a family of unknown type, so
+// that the names exposed with any format are valid OpenMetrics ones.
+func (om *OpenMetrics) Close() error {
+	out, err := createOutput(om.path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+
+	names := make([]string, 0, len(om.families))
+	for name := range om.families {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s unknown\n", name)
+		for _, ss := range sortedSeries(om.families[model.LabelValue(name)]) {
+			labels := formatLabels(ss.metric)
+			for _, sample := range ss.samples {
+				fmt.Fprintf(w, "%s%s %s %s\n", name, labels, formatValue(sample.Value), formatTimestamp(sample.Timestamp))
+			}
+		}
+	}
+	fmt.Fprint(w, "# EOF\n")
+
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Capabilities of the OpenMetrics file: float samples only, promtool does
+// not backfill exemplars nor metadata
+func (om *OpenMetrics) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// sortedSeries returns the series sorted by labels, with their samples
+// sorted by timestamp and without duplicated timestamps
+func sortedSeries(family map[model.Fingerprint]*series) []*series {
+	result := make([]*series, 0, len(family))
+	for _, ss := range family {
+		sort.SliceStable(ss.samples, func(i, j int) bool { return ss.samples[i].Timestamp < ss.samples[j].Timestamp })
+		samples := ss.samples[:0]
+		for i, sample := range ss.samples {
+			if i == 0 || sample.Timestamp != ss.samples[i-1].Timestamp {
+				samples = append(samples, sample)
+			}
+		}
+		ss.samples = samples
+		result = append(result, ss)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].metric.Before(result[j].metric) })
+	return result
+}
+
+// formatLabels formats the labels, but the metric name, sorted by name
+func formatLabels(metric model.Metric) string {
+	names := make([]string, 0, len(metric))
+	for name := range metric {
+		if name != model.MetricNameLabel {
+			names = append(names, string(name))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(string(metric[model.LabelName(name)]))+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value model.SampleValue) string {
+	f := float64(value)
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatTimestamp formats the timestamp in seconds with the milliseconds,
+// the sign written apart for the timestamps before 1970
+func formatTimestamp(t model.Time) string {
+	sign := ""
+	if t < 0 {
+		sign, t = "-", -t
+	}
+	return fmt.Sprintf("%s%d.%03d", sign, int64(t)/1000, int64(t)%1000)
+}
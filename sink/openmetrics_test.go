@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sink")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.om")
+
+	up := model.Metric{model.MetricNameLabel: "up", "job": "app", "url": "http://a/metrics"}
+	msg := model.Metric{model.MetricNameLabel: "info", "job": "app", "msg": "say \"hi\"\n"}
+	om := NewOpenMetrics(path)
+	om.Append(&Batch{Samples: model.Vector{
+		{Metric: up, Value: 1, Timestamp: 2000},
+		{Metric: msg, Value: model.SampleValue(math.Inf(1)), Timestamp: 1500},
+	}})
+	om.Append(&Batch{Samples: model.Vector{
+		{Metric: up, Value: 0, Timestamp: 1001},
+		{Metric: up, Value: 5, Timestamp: 2000},
+		{Metric: up, Value: 2, Timestamp: -1500},
+	}})
+	assert.Empty(t, om.Flush(), "should not be any error")
+	assert.Empty(t, om.Close(), "should not be any error")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Empty(t, err, "the file should be written")
+	assert.Equal(t, `# TYPE info unknown
+info{job="app",msg="say \"hi\"\n"} +Inf 1.500
+# TYPE up unknown
+up{job="app",url="http://a/metrics"} 2 -1.500
+up{job="app",url="http://a/metrics"} 0 1.001
+up{job="app",url="http://a/metrics"} 1 2.000
+# EOF
+`, string(data), "families should be contiguous and samples sorted by timestamp")
+}
@@ -0,0 +1,428 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cleafy/promqueen/otlp"
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+)
+
+// otlpScope is the instrumentation scope of the exported metrics
+const otlpScope = "github.com/Cleafy/promqueen"
+
+// OTLPOptions configures the OTLP sink:
+//  - the URL of the OTLP/HTTP metrics endpoint (eg.
+//    http://collector:4318/v1/metrics) along with the extra Headers and the
+//    Timeout of the requests; without URL the requests are written to the
+//    Output file, one per line
+type OTLPOptions struct {
+	Output  string
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+// OTLP converts the samples into OpenTelemetry metrics, a request per batch,
+// sent in the OTLP/JSON encoding. The job and url labels become the
+// service.name and service.instance.id resource attributes, the other labels
+// the attributes of the points. The metadata tells how the samples are
+// converted:
+//  - counters become monotonic cumulative sums, their _created samples the
+//    start time of the points
+//  - classic histograms and summaries are assembled from their samples,
+//    native histograms become exponential histograms
+//  - the other samples become gauges
+type OTLP struct {
+	options  OTLPOptions
+	client   *http.Client
+	out      io.WriteCloser
+	writer   *bufio.Writer
+	metadata map[string]*playback.Metadata
+}
+
+// NewOTLP generates a new OTLP sink, creating the output file when no URL is
+// given
+func NewOTLP(options OTLPOptions) (*OTLP, error) {
+	o := &OTLP{
+		options:  options,
+		client:   &http.Client{Timeout: options.Timeout},
+		metadata: make(map[string]*playback.Metadata),
+	}
+	if options.URL == "" {
+		out, err := createOutput(options.Output)
+		if err != nil {
+			return nil, err
+		}
+		o.out = out
+		o.writer = bufio.NewWriter(out)
+	}
+	return o, nil
+}
+
+// Append converts the batch and sends it, or writes it as a line
+func (o *OTLP) Append(batch *Batch) error {
+	for _, md := range batch.Metadata {
+		o.metadata[md.MetricFamily] = md
+	}
+
+	c := &otlpConverter{metadata: o.metadata, resources: make(map[string]*otlpResource)}
+	for _, s := range batch.Samples {
+		c.addSample(s)
+	}
+	for _, h := range batch.Histograms {
+		c.addHistogram(h)
+	}
+	request := c.request()
+	if len(request.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if o.writer != nil {
+		o.writer.Write(data)
+		return o.writer.WriteByte('\n')
+	}
+	return post(o.client, o.options.URL, o.options.Headers, "application/json", data)
+}
+
+// Flush writes the buffered lines
+func (o *OTLP) Flush() error {
+	if o.writer != nil {
+		return o.writer.Flush()
+	}
+	return nil
+}
+
+// Close flushes the buffered lines and closes the file
+func (o *OTLP) Close() error {
+	err := o.Flush()
+	if o.out != nil {
+		if cerr := o.out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Capabilities of OTLP: native histograms and metadata
+func (o *OTLP) Capabilities() Capabilities {
+	return Capabilities{NativeHistograms: true, Metadata: true}
+}
+
+// otlpConverter converts the samples of a batch into OTLP metrics
+type otlpConverter struct {
+	metadata  map[string]*playback.Metadata
+	order     []*otlpResource
+	resources map[string]*otlpResource
+}
+
+// otlpResource holds the metrics of a job and url, along with the points
+// assembled from several samples
+type otlpResource struct {
+	metrics    *otlp.ScopeMetrics
+	resource   otlp.Resource
+	index      map[string]*otlp.Metric
+	histograms map[string]*classicHistogram
+	summaries  map[string]*otlp.SummaryDataPoint
+	starts     map[string][]*otlp.Uint64
+	created    map[string]otlp.Uint64
+}
+
+// classicHistogram is a histogram point being assembled from the cumulative
+// _bucket samples and the _count one
+type classicHistogram struct {
+	point    *otlp.HistogramDataPoint
+	buckets  map[float64]float64
+	count    float64
+	hasCount bool
+}
+
+// family returns the metric family of the sample along with its type and
+// the suffix of the sample name
+func (c *otlpConverter) family(name string) (string, string, string) {
+	if md, ok := c.metadata[name]; ok {
+		return name, md.Type, ""
+	}
+	for _, suffix := range []string{"_total", "_created", "_bucket", "_sum", "_count"} {
+		family := strings.TrimSuffix(name, suffix)
+		if md, ok := c.metadata[family]; ok {
+			return family, md.Type, suffix
+		}
+	}
+	return name, "unknown", ""
+}
+
+func (c *otlpConverter) addSample(s *model.Sample) {
+	res := c.resource(s.Metric)
+	name := string(s.Metric[model.MetricNameLabel])
+	family, typ, suffix := c.family(name)
+	attributes, key := otlpAttributes(s.Metric, family)
+	ts := unixNano(s.Timestamp)
+
+	switch {
+	case suffix == "_created" && (typ == "counter" || typ == "histogram" || typ == "summary"):
+		res.created[key] = otlp.Uint64(float64(s.Value) * 1e9)
+
+	case typ == "counter":
+		metric := c.metric(res, name, family)
+		if metric.Sum == nil {
+			metric.Sum = &otlp.Sum{AggregationTemporality: otlp.AggregationTemporalityCumulative, IsMonotonic: true}
+		}
+		point := &otlp.NumberDataPoint{Attributes: attributes, TimeUnixNano: ts, AsDouble: otlp.Double(s.Value)}
+		metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		res.starts[key] = append(res.starts[key], &point.StartTimeUnixNano)
+
+	case typ == "histogram":
+		attributes, key = otlpAttributes(s.Metric, family, model.BucketLabel)
+		h, ok := res.histograms[key]
+		if !ok {
+			metric := c.metric(res, family, family)
+			if metric.Histogram == nil {
+				metric.Histogram = &otlp.Histogram{AggregationTemporality: otlp.AggregationTemporalityCumulative}
+			}
+			h = &classicHistogram{
+				point:   &otlp.HistogramDataPoint{Attributes: attributes, TimeUnixNano: ts},
+				buckets: make(map[float64]float64),
+			}
+			metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, h.point)
+			res.histograms[key] = h
+			res.starts[key] = append(res.starts[key], &h.point.StartTimeUnixNano)
+		}
+		switch suffix {
+		case "_bucket":
+			if le, err := strconv.ParseFloat(string(s.Metric[model.BucketLabel]), 64); err == nil {
+				h.buckets[le] = float64(s.Value)
+			}
+		case "_sum":
+			sum := otlp.Double(s.Value)
+			h.point.Sum = &sum
+		case "_count":
+			h.count, h.hasCount = float64(s.Value), true
+		}
+
+	case typ == "summary":
+		attributes, key = otlpAttributes(s.Metric, family, model.QuantileLabel)
+		point, ok := res.summaries[key]
+		if !ok {
+			metric := c.metric(res, family, family)
+			if metric.Summary == nil {
+				metric.Summary = &otlp.Summary{}
+			}
+			point = &otlp.SummaryDataPoint{Attributes: attributes, TimeUnixNano: ts}
+			metric.Summary.DataPoints = append(metric.Summary.DataPoints, point)
+			res.summaries[key] = point
+			res.starts[key] = append(res.starts[key], &point.StartTimeUnixNano)
+		}
+		switch suffix {
+		case "":
+			if q, err := strconv.ParseFloat(string(s.Metric[model.QuantileLabel]), 64); err == nil {
+				point.QuantileValues = append(point.QuantileValues, otlp.ValueAtQuantile{Quantile: otlp.Double(q), Value: otlp.Double(s.Value)})
+			}
+		case "_sum":
+			point.Sum = otlp.Double(s.Value)
+		case "_count":
+			point.Count = otlpCount(float64(s.Value))
+		}
+
+	default:
+		metric := c.metric(res, name, family)
+		if metric.Gauge == nil {
+			metric.Gauge = &otlp.Gauge{}
+		}
+		point := &otlp.NumberDataPoint{Attributes: attributes, TimeUnixNano: ts, AsDouble: otlp.Double(s.Value)}
+		metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+	}
+}
+
+// addHistogram converts the native histogram into an exponential histogram:
+// the native bucket i covers (base^(i-1), base^i], one index ahead of OTLP
+func (c *otlpConverter) addHistogram(hs *playback.HistogramSample) {
+	res := c.resource(hs.Metric)
+	name := string(hs.Metric[model.MetricNameLabel])
+	attributes, key := otlpAttributes(hs.Metric, name)
+	h := hs.Histogram
+
+	metric := c.metric(res, name, name)
+	if metric.ExponentialHistogram == nil {
+		metric.ExponentialHistogram = &otlp.ExponentialHistogram{AggregationTemporality: otlp.AggregationTemporalityCumulative}
+	}
+	sum := otlp.Double(h.Sum)
+	point := &otlp.ExponentialHistogramDataPoint{
+		Attributes:    attributes,
+		TimeUnixNano:  unixNano(hs.Timestamp),
+		Count:         otlpCount(h.Count),
+		Sum:           &sum,
+		Scale:         h.Schema,
+		ZeroCount:     otlpCount(h.ZeroCount),
+		ZeroThreshold: otlp.Double(h.ZeroThreshold),
+		Positive:      otlpBuckets(h.PositiveSpans, h.PositiveBuckets),
+		Negative:      otlpBuckets(h.NegativeSpans, h.NegativeBuckets),
+	}
+	metric.ExponentialHistogram.DataPoints = append(metric.ExponentialHistogram.DataPoints, point)
+	res.starts[key] = append(res.starts[key], &point.StartTimeUnixNano)
+}
+
+// resource returns the resource of the job and url of the metric
+func (c *otlpConverter) resource(metric model.Metric) *otlpResource {
+	job, url := string(metric["job"]), string(metric["url"])
+	id := job + "\xff" + url
+	if res, ok := c.resources[id]; ok {
+		return res
+	}
+
+	res := &otlpResource{
+		metrics:    &otlp.ScopeMetrics{Scope: otlp.Scope{Name: otlpScope}},
+		resource:   otlp.Resource{Attributes: []otlp.KeyValue{}},
+		index:      make(map[string]*otlp.Metric),
+		histograms: make(map[string]*classicHistogram),
+		summaries:  make(map[string]*otlp.SummaryDataPoint),
+		starts:     make(map[string][]*otlp.Uint64),
+		created:    make(map[string]otlp.Uint64),
+	}
+	if job != "" {
+		res.resource.Attributes = append(res.resource.Attributes, otlpAttribute("service.name", job))
+	}
+	if url != "" {
+		res.resource.Attributes = append(res.resource.Attributes, otlpAttribute("service.instance.id", url))
+	}
+	c.resources[id] = res
+	c.order = append(c.order, res)
+	return res
+}
+
+// metric returns the metric of the resource with the given name, described
+// by the metadata of the family
+func (c *otlpConverter) metric(res *otlpResource, name, family string) *otlp.Metric {
+	if metric, ok := res.index[name]; ok {
+		return metric
+	}
+	metric := &otlp.Metric{Name: name}
+	if md, ok := c.metadata[family]; ok {
+		metric.Description = md.Help
+		metric.Unit = md.Unit
+	}
+	res.index[name] = metric
+	res.metrics.Metrics = append(res.metrics.Metrics, metric)
+	return metric
+}
+
+// request completes the assembled points and returns the request
+func (c *otlpConverter) request() *otlp.ExportMetricsServiceRequest {
+	request := &otlp.ExportMetricsServiceRequest{ResourceMetrics: []*otlp.ResourceMetrics{}}
+	for _, res := range c.order {
+		for _, h := range res.histograms {
+			h.complete()
+		}
+		for _, point := range res.summaries {
+			sort.Slice(point.QuantileValues, func(i, j int) bool {
+				return point.QuantileValues[i].Quantile < point.QuantileValues[j].Quantile
+			})
+		}
+		for key, created := range res.created {
+			for _, start := range res.starts[key] {
+				*start = created
+			}
+		}
+		request.ResourceMetrics = append(request.ResourceMetrics, &otlp.ResourceMetrics{
+			Resource:     res.resource,
+			ScopeMetrics: []*otlp.ScopeMetrics{res.metrics},
+		})
+	}
+	return request
+}
+
+// complete converts the cumulative buckets into the bucket counts and
+// explicit bounds of the point, the +Inf bucket being the last one
+func (h *classicHistogram) complete() {
+	bounds := make([]float64, 0, len(h.buckets))
+	for le := range h.buckets {
+		if !math.IsInf(le, 1) {
+			bounds = append(bounds, le)
+		}
+	}
+	sort.Float64s(bounds)
+
+	total, ok := h.buckets[math.Inf(1)]
+	if h.hasCount {
+		total, ok = h.count, true
+	}
+	previous := 0.0
+	h.point.ExplicitBounds = make([]otlp.Double, 0, len(bounds))
+	h.point.BucketCounts = make([]otlp.Uint64, 0, len(bounds)+1)
+	for _, le := range bounds {
+		h.point.ExplicitBounds = append(h.point.ExplicitBounds, otlp.Double(le))
+		h.point.BucketCounts = append(h.point.BucketCounts, otlpCount(h.buckets[le]-previous))
+		previous = h.buckets[le]
+	}
+	if !ok {
+		total = previous
+	}
+	h.point.BucketCounts = append(h.point.BucketCounts, otlpCount(total-previous))
+	h.point.Count = otlpCount(total)
+}
+
+// otlpAttributes returns the attributes of the metric, sorted, leaving out
+// the metric name, the resource labels and the given labels, along with a
+// key identifying the point of the family
+func otlpAttributes(metric model.Metric, family string, exclude ...model.LabelName) ([]otlp.KeyValue, string) {
+	excluded := map[model.LabelName]bool{model.MetricNameLabel: true, "job": true, "url": true}
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+
+	names := make(model.LabelNames, 0, len(metric))
+	for name, value := range metric {
+		if !excluded[name] && value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(names)
+
+	attributes := make([]otlp.KeyValue, 0, len(names))
+	key := family
+	for _, name := range names {
+		attributes = append(attributes, otlpAttribute(string(name), string(metric[name])))
+		key += "\xff" + string(name) + "\xff" + string(metric[name])
+	}
+	return attributes, key
+}
+
+func otlpAttribute(key, value string) otlp.KeyValue {
+	return otlp.KeyValue{Key: key, Value: otlp.AnyValue{StringValue: value}}
+}
+
+// otlpBuckets converts the native buckets laid out by the spans into
+// consecutive OTLP buckets
+func otlpBuckets(spans []playback.Span, counts []float64) otlp.Buckets {
+	offset, dense := playback.DenseBuckets(spans, counts)
+	buckets := otlp.Buckets{Offset: offset - 1, BucketCounts: make([]otlp.Uint64, 0, len(dense))}
+	for _, count := range dense {
+		buckets.BucketCounts = append(buckets.BucketCounts, otlpCount(count))
+	}
+	return buckets
+}
+
+// otlpCount rounds the count, negative ones (eg. from buckets decreasing
+// across a scrape) being zero
+func otlpCount(count float64) otlp.Uint64 {
+	if count <= 0 || math.IsNaN(count) {
+		return 0
+	}
+	return otlp.Uint64(math.Round(count))
+}
+
+func unixNano(t model.Time) otlp.Uint64 {
+	return otlp.Uint64(int64(t) * int64(time.Millisecond))
+}
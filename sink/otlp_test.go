@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func otlpBatch() *Batch {
+	target := model.Metric{"job": "app", "url": "http://a/metrics"}
+	metric := func(name string, labels ...string) model.Metric {
+		m := target.Clone()
+		m[model.MetricNameLabel] = model.LabelValue(name)
+		for i := 0; i < len(labels); i += 2 {
+			m[model.LabelName(labels[i])] = model.LabelValue(labels[i+1])
+		}
+		return m
+	}
+	return &Batch{
+		Samples: model.Vector{
+			{Metric: metric("requests_total", "code", "200"), Value: 7, Timestamp: 2000},
+			{Metric: metric("requests_created", "code", "200"), Value: 1.5, Timestamp: 2000},
+			{Metric: metric("temperature"), Value: 21.5, Timestamp: 2000},
+			{Metric: metric("latency_bucket", "le", "0.1"), Value: 2, Timestamp: 2000},
+			{Metric: metric("latency_bucket", "le", "1"), Value: 5, Timestamp: 2000},
+			{Metric: metric("latency_bucket", "le", "+Inf"), Value: 6, Timestamp: 2000},
+			{Metric: metric("latency_sum"), Value: 3.25, Timestamp: 2000},
+			{Metric: metric("latency_count"), Value: 6, Timestamp: 2000},
+		},
+		Metadata: []*playback.Metadata{
+			{MetricFamily: "requests", Type: "counter", Help: "Requests served."},
+			{MetricFamily: "temperature", Type: "gauge", Unit: "celsius"},
+			{MetricFamily: "latency", Type: "histogram"},
+		},
+	}
+}
+
+func TestOTLPFile(t *testing.T) {
+	data := writeSink(t, func(output string) (Sink, error) {
+		return NewOTLP(OTLPOptions{Output: output})
+	}, otlpBatch())
+	assert.JSONEq(t, `{"resourceMetrics": [{
+		"resource": {"attributes": [
+			{"key": "service.name", "value": {"stringValue": "app"}},
+			{"key": "service.instance.id", "value": {"stringValue": "http://a/metrics"}}
+		]},
+		"scopeMetrics": [{"scope": {"name": "github.com/Cleafy/promqueen"}, "metrics": [
+			{"name": "requests_total", "description": "Requests served.", "sum": {
+				"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [{
+					"attributes": [{"key": "code", "value": {"stringValue": "200"}}],
+					"startTimeUnixNano": "1500000000", "timeUnixNano": "2000000000", "asDouble": 7
+				}]
+			}},
+			{"name": "temperature", "unit": "celsius", "gauge": {"dataPoints": [
+				{"timeUnixNano": "2000000000", "asDouble": 21.5}
+			]}},
+			{"name": "latency", "histogram": {"aggregationTemporality": 2, "dataPoints": [{
+				"timeUnixNano": "2000000000", "count": "6", "sum": 3.25,
+				"bucketCounts": ["2", "3", "1"], "explicitBounds": [0.1, 1]
+			}]}}
+		]}]
+	}]}`, string(data), "the samples should be converted according to their type")
+}
+
+func TestOTLPNativeHistogram(t *testing.T) {
+	c := &otlpConverter{metadata: map[string]*playback.Metadata{}, resources: make(map[string]*otlpResource)}
+	c.addHistogram(&playback.HistogramSample{
+		Metric: model.Metric{model.MetricNameLabel: "latency", "job": "app"},
+		Histogram: &playback.Histogram{
+			Schema:          1,
+			Count:           6,
+			Sum:             10,
+			ZeroCount:       1,
+			PositiveSpans:   []playback.Span{{Offset: 0, Length: 1}, {Offset: 1, Length: 1}},
+			PositiveBuckets: []float64{2, 3},
+		},
+		Timestamp: 1000,
+	})
+
+	metric := c.request().ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	point := metric.ExponentialHistogram.DataPoints[0]
+	assert.Equal(t, int32(1), point.Scale, "the schema should be the scale")
+	assert.Equal(t, int32(-1), point.Positive.Offset, "the bucket indexes should be shifted by one")
+	assert.Equal(t, 3, len(point.Positive.BucketCounts), "the gaps between the spans should be filled")
+	assert.Equal(t, uint64(6), uint64(point.Count), "the count should be kept")
+}
+
+func TestOTLPHTTP(t *testing.T) {
+	var requests int
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	o, err := NewOTLP(OTLPOptions{URL: server.URL + "/v1/metrics"})
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, o.Append(otlpBatch()), "should not be any error")
+	assert.Empty(t, o.Append(&Batch{}), "should not be any error")
+	assert.Empty(t, o.Close(), "should not be any error")
+	assert.Equal(t, 1, requests, "a request should be sent for every non empty batch")
+	assert.Equal(t, "application/json", contentType, "the requests should be OTLP/JSON")
+}
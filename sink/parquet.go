@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// DefaultRowGroupSize is the size of the Parquet row groups, the one
+// recommended for analytics engines
+const DefaultRowGroupSize = 128 * 1024 * 1024
+
+// Compressions of the Parquet pages
+var Compressions = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+}
+
+// parquetColumns are the columns of every Parquet file
+var parquetColumns = []string{"timestamp", "name", "labels", "value"}
+
+// ParquetOptions configures the Parquet sink:
+//  - the Output file
+//  - the Labels promoted to their own columns, null when missing, instead
+//    of being kept in the labels map
+//  - the RowGroupSize in bytes and the Compression (see Compressions)
+type ParquetOptions struct {
+	Output       string
+	Labels       []string
+	RowGroupSize int64
+	Compression  string
+}
+
+// Parquet writes the samples as a Parquet file with a row per sample: the
+// timestamp (milliseconds), the metric name, the labels map along with the
+// promoted label columns, and the value.
+type Parquet struct {
+	options  ParquetOptions
+	promoted map[model.LabelName]bool
+	out      io.WriteCloser
+	writer   *writer.JSONWriter
+}
+
+// NewParquet generates a new Parquet sink creating the output file
+func NewParquet(options ParquetOptions) (*Parquet, error) {
+	compression, ok := Compressions[options.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", options.Compression)
+	}
+
+	// the columns are matched by their Go-like name, which has to be unique
+	names := make(map[string]string)
+	promoted := make(map[model.LabelName]bool)
+	for _, column := range append(parquetColumns, options.Labels...) {
+		name := common.StringToVariableName(column)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("label %q conflicts with the %q column", column, other)
+		}
+		names[name] = column
+	}
+	for _, label := range options.Labels {
+		if !model.LabelName(label).IsValid() {
+			return nil, fmt.Errorf("invalid label name %q", label)
+		}
+		promoted[model.LabelName(label)] = true
+	}
+
+	out, err := createOutput(options.Output)
+	if err != nil {
+		return nil, err
+	}
+	w, err := writer.NewJSONWriterFromWriter(parquetSchema(options.Labels), out, 4)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	w.RowGroupSize = options.RowGroupSize
+	w.CompressionType = compression
+
+	return &Parquet{
+		options:  options,
+		promoted: promoted,
+		out:      out,
+		writer:   w,
+	}, nil
+}
+
+// parquetSchema returns the schema of the file, as parquet-go JSON schema
+func parquetSchema(labels []string) string {
+	fields := []string{
+		`{"Tag": "name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=REQUIRED"}`,
+		`{"Tag": "name=name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}`,
+		`{"Tag": "name=labels, type=MAP, repetitiontype=REQUIRED", "Fields": [` +
+			`{"Tag": "name=key, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}, ` +
+			`{"Tag": "name=value, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}]}`,
+	}
+	for _, label := range labels {
+		fields = append(fields, fmt.Sprintf(`{"Tag": "name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"}`, label))
+	}
+	fields = append(fields, `{"Tag": "name=value, type=DOUBLE, repetitiontype=REQUIRED"}`)
+
+	return `{"Tag": "name=parquet_go_root, repetitiontype=REQUIRED", "Fields": [` + strings.Join(fields, ", ") + `]}`
+}
+
+// Append writes a row for every sample, the rows are buffered until a row
+// group is complete
+func (p *Parquet) Append(batch *Batch) error {
+	for _, s := range batch.Samples {
+		row := map[string]interface{}{
+			"timestamp": int64(s.Timestamp),
+			"name":      string(s.Metric[model.MetricNameLabel]),
+			"value":     jsonValue(s.Value),
+		}
+		labels := make(map[string]string, len(s.Metric))
+		for name, value := range s.Metric {
+			switch {
+			case name == model.MetricNameLabel || value == "":
+			case p.promoted[name]:
+				row[string(name)] = string(value)
+			default:
+				labels[string(name)] = string(value)
+			}
+		}
+		row["labels"] = labels
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if err := p.writer.Write(string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered rows as a row group
+func (p *Parquet) Flush() error {
+	return p.writer.Flush(true)
+}
+
+// Close writes the buffered rows along with the footer, and closes the file
+func (p *Parquet) Close() error {
+	err := p.writer.WriteStop()
+	if cerr := p.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Capabilities of Parquet: float samples only
+func (p *Parquet) Capabilities() Capabilities {
+	return Capabilities{}
+}
@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetFile(t *testing.T) {
+	data := writeSink(t, func(output string) (Sink, error) {
+		return NewParquet(ParquetOptions{Output: output, Labels: []string{"job"}, RowGroupSize: DefaultRowGroupSize, Compression: "zstd"})
+	}, &Batch{Samples: model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app", "url": "http://a/metrics"}, Value: 1, Timestamp: 1500},
+		{Metric: model.Metric{"__name__": "build_info"}, Value: 2.5, Timestamp: 2000},
+	}})
+	file, _ := buffer.NewBufferFile([]byte(data))
+	r, err := reader.NewParquetReader(file, nil, 1)
+	assert.Empty(t, err, "the file should be readable")
+	assert.Equal(t, int64(2), r.GetNumRows(), "a row should be written for every sample")
+
+	rows, err := r.ReadByNumber(2)
+	assert.Empty(t, err, "the rows should be readable")
+	js, _ := json.Marshal(rows)
+	assert.JSONEq(t, `[
+		{"Timestamp": 1500, "Name": "up", "Labels": {"url": "http://a/metrics"}, "Job": "app", "Value": 1},
+		{"Timestamp": 2000, "Name": "build_info", "Labels": {}, "Job": null, "Value": 2.5}
+	]`, string(js), "the promoted labels should have their own column")
+}
+
+func TestParquetConflicts(t *testing.T) {
+	_, err := NewParquet(ParquetOptions{Output: "-", Labels: []string{"value"}, Compression: "snappy"})
+	assert.NotEmpty(t, err, "labels conflicting with the columns should be rejected")
+	_, err = NewParquet(ParquetOptions{Output: "-", Compression: "lzma"})
+	assert.NotEmpty(t, err, "unknown compressions should be rejected")
+}
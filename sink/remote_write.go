@@ -0,0 +1,441 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/Cleafy/promqueen/prompb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// RemoteWriteOptions configures the RemoteWrite sink:
+//  - the URL of the remote write endpoint, the Timeout of every request and
+//    the extra Headers to send (eg. X-Scope-OrgID)
+//  - the number of Shards sending concurrently, every series always goes
+//    through the same shard so that its samples are sent in order
+//  - the BatchSize, maximum number of samples and histograms per request
+//  - the MaxRetries of the requests failing with a 5xx/429 status or a
+//    network error, with an exponential backoff from MinBackoff to MaxBackoff
+type RemoteWriteOptions struct {
+	URL        string
+	Timeout    time.Duration
+	Headers    map[string]string
+	Shards     int
+	BatchSize  int
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// RemoteWrite pushes the data to a Prometheus remote write endpoint (eg.
+// Thanos, Cortex, Mimir or VictoriaMetrics)
+type RemoteWrite struct {
+	options  RemoteWriteOptions
+	client   *http.Client
+	shards   []*shard
+	running  sync.WaitGroup
+	metadata map[string]prompb.MetricMetadata
+	sent     map[string]prompb.MetricMetadata
+
+	mtx sync.Mutex
+	err error
+}
+
+// NewRemoteWrite starts the shards of a new RemoteWrite sink
+func NewRemoteWrite(options RemoteWriteOptions) *RemoteWrite {
+	if options.Shards < 1 {
+		options.Shards = 1
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 1
+	}
+
+	rw := &RemoteWrite{
+		options:  options,
+		client:   &http.Client{Timeout: options.Timeout},
+		metadata: make(map[string]prompb.MetricMetadata),
+		sent:     make(map[string]prompb.MetricMetadata),
+	}
+	for i := 0; i < options.Shards; i++ {
+		s := &shard{
+			rw:       rw,
+			pending:  make(map[model.Fingerprint]*pendingSeries),
+			requests: make(chan map[model.Fingerprint]*pendingSeries, 1),
+			last:     make(map[model.Fingerprint]int64),
+			lastHist: make(map[model.Fingerprint]int64),
+		}
+		rw.shards = append(rw.shards, s)
+		rw.running.Add(1)
+		go s.run()
+	}
+	return rw
+}
+
+// Append dispatches the batch to the shards, a shard sends a request as soon
+// as it holds BatchSize samples. It returns the error of the requests that
+// failed after all the retries, if any.
+func (rw *RemoteWrite) Append(batch *Batch) error {
+	if err := rw.error(); err != nil {
+		return err
+	}
+
+	for _, s := range batch.Samples {
+		series, shard := rw.series(s.Metric)
+		series.samples = append(series.samples, &prompb.Sample{Value: float64(s.Value), Timestamp: int64(s.Timestamp)})
+		shard.added()
+	}
+	for _, h := range batch.Histograms {
+		series, shard := rw.series(h.Metric)
+		series.histograms = append(series.histograms, toHistogram(h.Histogram, h.Timestamp))
+		shard.added()
+	}
+	for _, e := range batch.Exemplars {
+		series, _ := rw.series(e.Metric)
+		timestamp := int64(e.Timestamp)
+		if !e.HasTimestamp && len(series.samples) > 0 {
+			timestamp = series.samples[len(series.samples)-1].Timestamp
+		}
+		series.exemplars = append(series.exemplars, &prompb.Exemplar{
+			Labels:    prompb.LabelsFromMetric(model.Metric(e.Labels)),
+			Value:     float64(e.Value),
+			Timestamp: timestamp,
+		})
+	}
+	for _, md := range batch.Metadata {
+		rw.metadata[md.MetricFamily] = prompb.MetricMetadata{
+			Type:             prompb.MetricTypes[md.Type],
+			MetricFamilyName: md.MetricFamily,
+			Help:             md.Help,
+			Unit:             md.Unit,
+		}
+	}
+	return nil
+}
+
+// Flush sends all the pending data and waits for the requests in flight.
+// The metadata changed since the last Flush is sent in a request of its own.
+func (rw *RemoteWrite) Flush() error {
+	for _, s := range rw.shards {
+		s.enqueue()
+	}
+	for _, s := range rw.shards {
+		s.inflight.Wait()
+	}
+
+	metadata := make([]*prompb.MetricMetadata, 0)
+	for name, md := range rw.metadata {
+		if rw.sent[name] != md {
+			md := md
+			metadata = append(metadata, &md)
+			rw.sent[name] = md
+		}
+	}
+	if len(metadata) > 0 {
+		sort.Slice(metadata, func(i, j int) bool { return metadata[i].MetricFamilyName < metadata[j].MetricFamilyName })
+		if err := rw.send(&prompb.WriteRequest{Metadata: metadata}); err != nil {
+			rw.setError(err)
+		}
+	}
+	return rw.error()
+}
+
+// Close flushes the pending data and stops the shards
+func (rw *RemoteWrite) Close() error {
+	err := rw.Flush()
+	for _, s := range rw.shards {
+		close(s.requests)
+	}
+	rw.running.Wait()
+	return err
+}
+
+// Capabilities of remote write: native histograms, exemplars and metadata
+func (rw *RemoteWrite) Capabilities() Capabilities {
+	return Capabilities{
+		NativeHistograms: true,
+		Exemplars:        true,
+		Metadata:         true,
+	}
+}
+
+// series returns the pending series of the metric and its shard
+func (rw *RemoteWrite) series(metric model.Metric) (*pendingSeries, *shard) {
+	fp := metric.Fingerprint()
+	s := rw.shards[uint64(fp)%uint64(len(rw.shards))]
+	series, ok := s.pending[fp]
+	if !ok {
+		series = &pendingSeries{metric: metric}
+		s.pending[fp] = series
+	}
+	return series, s
+}
+
+func (rw *RemoteWrite) error() error {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	return rw.err
+}
+
+func (rw *RemoteWrite) setError(err error) {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.err == nil {
+		rw.err = err
+	}
+}
+
+// recoverableError is returned for the requests worth retrying, after
+// retryAfter when the receiver asked for it
+type recoverableError struct {
+	error
+	retryAfter time.Duration
+}
+
+// send sends the request, retrying on the recoverable errors. Requests
+// rejected by the receiver (4xx other than 429) are dropped, as Prometheus
+// does, since retrying them would fail again.
+func (rw *RemoteWrite) send(req *prompb.WriteRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, data)
+
+	backoff := rw.options.MinBackoff
+	for try := 0; ; try++ {
+		err := rw.post(body)
+		if err == nil {
+			return nil
+		}
+		recoverable, ok := err.(recoverableError)
+		if !ok {
+			logrus.Errorf("Remote write of %d series dropped: %v", len(req.Timeseries), err)
+			return nil
+		}
+		if try >= rw.options.MaxRetries {
+			return fmt.Errorf("remote write failed after %d retries: %v", try, err)
+		}
+
+		wait := backoff
+		if recoverable.retryAfter > wait {
+			wait = recoverable.retryAfter
+		}
+		logrus.Warnf("Remote write failed, retrying in %v: %v", wait, err)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > rw.options.MaxBackoff {
+			backoff = rw.options.MaxBackoff
+		}
+	}
+}
+
+// post posts the snappy compressed request body
+func (rw *RemoteWrite) post(body []byte) error {
+	httpReq, err := http.NewRequest(http.MethodPost, rw.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range rw.options.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "promplay")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := rw.client.Do(httpReq)
+	if err != nil {
+		return recoverableError{error: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(message))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := time.Duration(0)
+		if seconds, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return recoverableError{error: err, retryAfter: retryAfter}
+	}
+	return err
+}
+
+// pendingSeries is the data of a series waiting to be sent
+type pendingSeries struct {
+	metric     model.Metric
+	samples    []*prompb.Sample
+	histograms []*prompb.Histogram
+	exemplars  []*prompb.Exemplar
+}
+
+// shard sends the requests of the series it owns one at a time, remembering
+// the last timestamp sent for every series
+type shard struct {
+	rw       *RemoteWrite
+	pending  map[model.Fingerprint]*pendingSeries
+	count    int
+	requests chan map[model.Fingerprint]*pendingSeries
+	inflight sync.WaitGroup
+	last     map[model.Fingerprint]int64
+	lastHist map[model.Fingerprint]int64
+}
+
+// added counts a sample added to the pending series, enqueueing them once
+// the batch is full
+func (s *shard) added() {
+	if s.count++; s.count >= s.rw.options.BatchSize {
+		s.enqueue()
+	}
+}
+
+// enqueue hands the pending series over to the sending goroutine, blocking
+// while the previous request is still queued
+func (s *shard) enqueue() {
+	if len(s.pending) == 0 {
+		return
+	}
+	s.inflight.Add(1)
+	s.requests <- s.pending
+	s.pending = make(map[model.Fingerprint]*pendingSeries)
+	s.count = 0
+}
+
+func (s *shard) run() {
+	defer s.rw.running.Done()
+	for pending := range s.requests {
+		if req := s.request(pending); len(req.Timeseries) > 0 {
+			if err := s.rw.send(req); err != nil {
+				s.rw.setError(err)
+			}
+		}
+		s.inflight.Done()
+	}
+}
+
+// request builds the request of the pending series. The samples of every
+// series are sorted by timestamp and the ones not newer than the last sent
+// are dropped, since the receivers reject out of order samples.
+func (s *shard) request(pending map[model.Fingerprint]*pendingSeries) *prompb.WriteRequest {
+	fps := make([]model.Fingerprint, 0, len(pending))
+	for fp := range pending {
+		fps = append(fps, fp)
+	}
+	sort.Slice(fps, func(i, j int) bool { return fps[i] < fps[j] })
+
+	dropped := 0
+	req := &prompb.WriteRequest{}
+	for _, fp := range fps {
+		series := pending[fp]
+
+		sort.SliceStable(series.samples, func(i, j int) bool { return series.samples[i].Timestamp < series.samples[j].Timestamp })
+		samples := series.samples[:0]
+		for _, sample := range series.samples {
+			if last, ok := s.last[fp]; ok && sample.Timestamp <= last {
+				dropped++
+				continue
+			}
+			samples = append(samples, sample)
+			s.last[fp] = sample.Timestamp
+		}
+
+		sort.SliceStable(series.histograms, func(i, j int) bool { return series.histograms[i].Timestamp < series.histograms[j].Timestamp })
+		histograms := series.histograms[:0]
+		for _, h := range series.histograms {
+			if last, ok := s.lastHist[fp]; ok && h.Timestamp <= last {
+				dropped++
+				continue
+			}
+			histograms = append(histograms, h)
+			s.lastHist[fp] = h.Timestamp
+		}
+
+		sort.SliceStable(series.exemplars, func(i, j int) bool { return series.exemplars[i].Timestamp < series.exemplars[j].Timestamp })
+		if len(samples) == 0 && len(histograms) == 0 && len(series.exemplars) == 0 {
+			continue
+		}
+		req.Timeseries = append(req.Timeseries, &prompb.TimeSeries{
+			Labels:     prompb.LabelsFromMetric(series.metric),
+			Samples:    samples,
+			Exemplars:  series.exemplars,
+			Histograms: histograms,
+		})
+	}
+
+	if dropped > 0 {
+		logrus.Infof("%d out of order samples discarded", dropped)
+	}
+	return req
+}
+
+// toHistogram converts the native histogram, integer counts are delta
+// encoded as the exposed ones while float counts are sent as they are
+func toHistogram(h *playback.Histogram, timestamp model.Time) *prompb.Histogram {
+	ph := &prompb.Histogram{
+		Sum:           h.Sum,
+		Schema:        h.Schema,
+		ZeroThreshold: h.ZeroThreshold,
+		NegativeSpans: toSpans(h.NegativeSpans),
+		PositiveSpans: toSpans(h.PositiveSpans),
+		Timestamp:     int64(timestamp),
+	}
+
+	if isInteger(h.Count) && isInteger(h.ZeroCount) && areIntegers(h.PositiveBuckets) && areIntegers(h.NegativeBuckets) {
+		count, zeroCount := uint64(h.Count), uint64(h.ZeroCount)
+		ph.CountInt, ph.ZeroCountInt = &count, &zeroCount
+		ph.PositiveDeltas = deltas(h.PositiveBuckets)
+		ph.NegativeDeltas = deltas(h.NegativeBuckets)
+	} else {
+		count, zeroCount := h.Count, h.ZeroCount
+		ph.CountFloat, ph.ZeroCountFloat = &count, &zeroCount
+		ph.PositiveCounts = h.PositiveBuckets
+		ph.NegativeCounts = h.NegativeBuckets
+	}
+	return ph
+}
+
+func toSpans(spans []playback.Span) []*prompb.BucketSpan {
+	result := make([]*prompb.BucketSpan, 0, len(spans))
+	for _, s := range spans {
+		result = append(result, &prompb.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+	return result
+}
+
+func deltas(counts []float64) []int64 {
+	result := make([]int64, 0, len(counts))
+	previous := int64(0)
+	for _, c := range counts {
+		result = append(result, int64(c)-previous)
+		previous = int64(c)
+	}
+	return result
+}
+
+func isInteger(f float64) bool {
+	return f >= 0 && f == math.Trunc(f)
+}
+
+func areIntegers(fs []float64) bool {
+	for _, f := range fs {
+		if !isInteger(f) {
+			return false
+		}
+	}
+	return true
+}
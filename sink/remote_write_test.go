@@ -0,0 +1,223 @@
+package sink
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/Cleafy/promqueen/prompb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a stand-in remote write receiver, it answers with the given
+// statuses before accepting the requests
+type receiver struct {
+	mtx      sync.Mutex
+	statuses []int
+	attempts int
+	requests []*prompb.WriteRequest
+	headers  http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.attempts++
+	r.headers = req.Header
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	compressed, _ := ioutil.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wr := &prompb.WriteRequest{}
+	if err := proto.Unmarshal(data, wr); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, wr)
+}
+
+// series returns the samples received for every series, by metric name
+func (r *receiver) series() map[string][]*prompb.Sample {
+	out := make(map[string][]*prompb.Sample)
+	for _, req := range r.requests {
+		for _, ts := range req.Timeseries {
+			name := string(prompb.MetricFromLabels(ts.Labels)[model.MetricNameLabel])
+			out[name] = append(out[name], ts.Samples...)
+		}
+	}
+	return out
+}
+
+func newTestRemoteWrite(url string, shards, batchSize int) *RemoteWrite {
+	return NewRemoteWrite(RemoteWriteOptions{
+		URL:        url,
+		Timeout:    time.Second,
+		Headers:    map[string]string{"X-Scope-OrgID": "tenant"},
+		Shards:     shards,
+		BatchSize:  batchSize,
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	})
+}
+
+func samples(name string, timestamps ...int64) model.Vector {
+	vector := model.Vector{}
+	for _, t := range timestamps {
+		vector = append(vector, &model.Sample{
+			Metric:    model.Metric{model.MetricNameLabel: model.LabelValue(name)},
+			Value:     model.SampleValue(t),
+			Timestamp: model.Time(t),
+		})
+	}
+	return vector
+}
+
+func TestRemoteWriteBatching(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	rw := newTestRemoteWrite(server.URL, 4, 10)
+	for i := int64(0); i < 10; i++ {
+		batch := append(samples("a", i*10), samples("b", i*10)...)
+		batch = append(batch, samples("c", i*10)...)
+		assert.Empty(t, rw.Append(&Batch{Samples: batch}), "should not be any error")
+	}
+	assert.Empty(t, rw.Close(), "should not be any error")
+
+	series := r.series()
+	assert.Equal(t, 3, len(series), "all the series should be received")
+	for name, s := range series {
+		assert.Equal(t, 10, len(s), "all the samples of %s should be received", name)
+	}
+	assert.Equal(t, "tenant", r.headers.Get("X-Scope-OrgID"), "the extra headers should be sent")
+	assert.Equal(t, "snappy", r.headers.Get("Content-Encoding"), "the body should be snappy compressed")
+}
+
+func TestRemoteWriteOrdering(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	rw := newTestRemoteWrite(server.URL, 1, 100)
+	rw.Append(&Batch{Samples: samples("a", 30, 10, 20)})
+	rw.Flush()
+	rw.Append(&Batch{Samples: samples("a", 15, 40, 30)})
+	assert.Empty(t, rw.Close(), "should not be any error")
+
+	timestamps := []int64{}
+	for _, s := range r.series()["a"] {
+		timestamps = append(timestamps, s.Timestamp)
+	}
+	assert.Equal(t, []int64{10, 20, 30, 40}, timestamps, "samples should be sorted and the out of order ones dropped")
+}
+
+func TestRemoteWriteRetry(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	rw := newTestRemoteWrite(server.URL, 1, 100)
+	rw.Append(&Batch{Samples: samples("a", 10)})
+	assert.Empty(t, rw.Close(), "should not be any error")
+	assert.Equal(t, 3, r.attempts, "5xx and 429 should be retried")
+	assert.Equal(t, 1, len(r.series()["a"]), "the samples should be received after the retries")
+}
+
+func TestRemoteWriteRetriesExhausted(t *testing.T) {
+	r := &receiver{statuses: []int{503, 503, 503, 503, 503}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	rw := newTestRemoteWrite(server.URL, 1, 100)
+	rw.Append(&Batch{Samples: samples("a", 10)})
+	assert.NotEmpty(t, rw.Flush(), "the error should be returned once the retries are exhausted")
+	assert.Equal(t, 4, r.attempts, "the request should be retried MaxRetries times")
+	assert.NotEmpty(t, rw.Append(&Batch{Samples: samples("a", 20)}), "the error should be returned by the next Append")
+	rw.Close()
+}
+
+func TestRemoteWriteBadRequestDropped(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	rw := newTestRemoteWrite(server.URL, 1, 100)
+	rw.Append(&Batch{Samples: samples("a", 10)})
+	assert.Empty(t, rw.Flush(), "rejected requests should be dropped")
+	assert.Equal(t, 1, r.attempts, "rejected requests should not be retried")
+	rw.Append(&Batch{Samples: samples("a", 20)})
+	assert.Empty(t, rw.Close(), "should not be any error")
+	assert.Equal(t, 1, len(r.series()["a"]), "the following requests should be sent")
+}
+
+func TestRemoteWriteHistogramsExemplarsMetadata(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	metric := model.Metric{model.MetricNameLabel: "latency"}
+	rw := newTestRemoteWrite(server.URL, 2, 100)
+	rw.Append(&Batch{
+		Samples: samples("requests_total", 1000),
+		Histograms: []*playback.HistogramSample{{
+			Metric: metric,
+			Histogram: &playback.Histogram{
+				Count:           5,
+				Sum:             12,
+				ZeroCount:       1,
+				PositiveSpans:   []playback.Span{{Offset: 0, Length: 2}},
+				PositiveBuckets: []float64{3, 1},
+			},
+			Timestamp: 1000,
+		}},
+		Exemplars: []*playback.Exemplar{{
+			Metric: samples("requests_total", 1000)[0].Metric,
+			Labels: model.LabelSet{"trace_id": "abc"},
+			Value:  1,
+		}},
+		Metadata: []*playback.Metadata{{MetricFamily: "requests", Type: "counter", Help: "Requests."}},
+	})
+	assert.Empty(t, rw.Close(), "should not be any error")
+
+	var histogram *prompb.Histogram
+	var exemplar *prompb.Exemplar
+	var metadata []*prompb.MetricMetadata
+	for _, req := range r.requests {
+		metadata = append(metadata, req.Metadata...)
+		for _, ts := range req.Timeseries {
+			if len(ts.Histograms) > 0 {
+				histogram = ts.Histograms[0]
+			}
+			if len(ts.Exemplars) > 0 {
+				exemplar = ts.Exemplars[0]
+			}
+		}
+	}
+
+	assert.NotNil(t, histogram, "the native histogram should be sent")
+	assert.Equal(t, uint64(5), *histogram.CountInt, "integer counts should be sent as integers")
+	assert.Equal(t, []int64{3, -2}, histogram.PositiveDeltas, "bucket counts should be delta encoded")
+	assert.Equal(t, int64(1000), histogram.Timestamp, "the timestamp should be sent")
+	assert.NotNil(t, exemplar, "the exemplar should be sent")
+	assert.Equal(t, int64(1000), exemplar.Timestamp, "exemplars without timestamp should get the sample one")
+	assert.Equal(t, []*prompb.MetricMetadata{{Type: prompb.MetricTypeCounter, MetricFamilyName: "requests", Help: "Requests."}}, metadata, "the metadata should be sent")
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+)
+
+// Capabilities tells which data, besides float samples, a Sink can store
+type Capabilities struct {
+	NativeHistograms bool
+	Exemplars        bool
+	Metadata         bool
+}
+
+// Batch is the data decoded from a frame:
+//  - the float Samples, synthetic series included
+//  - the native Histograms
+//  - the Exemplars attached to the samples
+//  - the Metadata of the metric families
+type Batch struct {
+	Samples    model.Vector
+	Histograms []*playback.HistogramSample
+	Exemplars  []*playback.Exemplar
+	Metadata   []*playback.Metadata
+}
+
+// Sink is an output promplay backfills the recorded data into
+//  - Append stores a batch, samples discarded by the output (eg. out of
+//    order ones) are logged and do not make it fail
+//  - Flush writes out the data buffered so far
+//  - Close flushes and releases the output
+//  - Capabilities tells which data the output supports
+type Sink interface {
+	Append(batch *Batch) error
+	Flush() error
+	Close() error
+	Capabilities() Capabilities
+}
+
+// For returns the batch restricted to the given capabilities: native
+// histograms are replaced by their classic samples, exemplars and metadata
+// are dropped when not supported
+func (batch *Batch) For(capabilities Capabilities) *Batch {
+	out := &Batch{Samples: batch.Samples}
+	if capabilities.NativeHistograms {
+		out.Histograms = batch.Histograms
+	} else if len(batch.Histograms) > 0 {
+		out.Samples = append(model.Vector{}, batch.Samples...)
+		for _, h := range batch.Histograms {
+			out.Samples = append(out.Samples, h.Classic...)
+		}
+	}
+	if capabilities.Exemplars {
+		out.Exemplars = batch.Exemplars
+	}
+	if capabilities.Metadata {
+		out.Metadata = batch.Metadata
+	}
+	return out
+}
+
+// nopCloser does not close the standard output
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// createOutput creates the output file of the file sinks, "-" stands for
+// the standard output
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// post posts the body to the url of the HTTP sinks along with the extra
+// headers, failing on non-2xx statuses
+func post(client *http.Client, url string, headers map[string]string, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
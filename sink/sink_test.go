@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cleafy/promqueen/blocks"
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSink appends the batch to the file sink opened on a temporary output
+// and returns what it wrote
+func writeSink(t *testing.T, open func(output string) (Sink, error), batch *Batch) string {
+	dir, _ := ioutil.TempDir("", "sink")
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "output")
+
+	s, err := open(output)
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, s.Append(batch), "should not be any error")
+	assert.Empty(t, s.Close(), "should not be any error")
+
+	data, err := ioutil.ReadFile(output)
+	assert.Empty(t, err, "the output should be written")
+	return string(data)
+}
+
+func testBatch() *Batch {
+	up := &model.Sample{Metric: model.Metric{"__name__": "up"}, Value: 1, Timestamp: 1000}
+	bucket := &model.Sample{Metric: model.Metric{"__name__": "latency_bucket", "le": "+Inf"}, Value: 3, Timestamp: 1000}
+	return &Batch{
+		Samples: model.Vector{up},
+		Histograms: []*playback.HistogramSample{{
+			Metric:    model.Metric{"__name__": "latency"},
+			Histogram: &playback.Histogram{Count: 3},
+			Timestamp: 1000,
+			Classic:   model.Vector{bucket},
+		}},
+		Exemplars: []*playback.Exemplar{{Metric: up.Metric, Value: 1}},
+		Metadata:  []*playback.Metadata{{MetricFamily: "up", Type: "gauge"}},
+	}
+}
+
+func TestBatchForFloatOnly(t *testing.T) {
+	batch := testBatch()
+	out := batch.For(Capabilities{})
+
+	assert.Equal(t, 2, len(out.Samples), "native histograms should be replaced by their classic samples")
+	assert.Empty(t, out.Histograms, "native histograms should be dropped")
+	assert.Empty(t, out.Exemplars, "exemplars should be dropped")
+	assert.Empty(t, out.Metadata, "metadata should be dropped")
+	assert.Equal(t, 1, len(batch.Samples), "the original batch should not be modified")
+}
+
+func TestBatchForAllCapabilities(t *testing.T) {
+	batch := testBatch()
+	out := batch.For(Capabilities{NativeHistograms: true, Exemplars: true, Metadata: true})
+
+	assert.Equal(t, batch.Samples, out.Samples, "samples should be kept")
+	assert.Equal(t, batch.Histograms, out.Histograms, "native histograms should be kept")
+	assert.Equal(t, batch.Exemplars, out.Exemplars, "exemplars should be kept")
+	assert.Equal(t, batch.Metadata, out.Metadata, "metadata should be kept")
+}
+
+func TestTSDBSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sink")
+	defer os.RemoveAll(dir)
+
+	var s Sink
+	s, err := NewTSDB(dir, blocks.DefaultBlockDuration)
+	assert.Empty(t, err, "should not be any error")
+	assert.True(t, s.Capabilities().NativeHistograms, "native histograms should be kept")
+	assert.Empty(t, s.Append(testBatch().For(s.Capabilities())), "should not be any error")
+	assert.Empty(t, s.Flush(), "should not be any error")
+	assert.Empty(t, s.Close(), "should not be any error")
+
+	metas, _ := filepath.Glob(filepath.Join(dir, "*", "meta.json"))
+	assert.Equal(t, 2, len(metas), "a block of samples and a block of histograms should be written")
+}
@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/common/model"
+)
+
+// Table formats and layouts
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	LayoutLong  = "long"
+	LayoutWide  = "wide"
+)
+
+// timeFormat is the format of the timestamps, RFC3339 with milliseconds
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// TableOptions configures the Table sink:
+//  - the Format (csv or jsonl) and the Output file
+//  - the Layout: long writes a row per sample (timestamp, name, labels,
+//    value), wide a row per timestamp with a column per series
+type TableOptions struct {
+	Format string
+	Layout string
+	Output string
+}
+
+// Table writes the samples as CSV or JSON Lines rows, for data analysis
+// tools. The wide layout needs all the series to build the columns, so the
+// samples are kept in memory and written on Close.
+type Table struct {
+	options TableOptions
+	out     io.WriteCloser
+	csv     *csv.Writer
+	jsonl   *bufio.Writer
+	columns map[string]bool
+	rows    map[model.Time]map[string]model.SampleValue
+}
+
+// NewTable generates a new Table sink creating the output file
+func NewTable(options TableOptions) (*Table, error) {
+	out, err := createOutput(options.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{
+		options: options,
+		out:     out,
+		columns: make(map[string]bool),
+		rows:    make(map[model.Time]map[string]model.SampleValue),
+	}
+	if options.Format == FormatCSV {
+		t.csv = csv.NewWriter(out)
+		if options.Layout == LayoutLong {
+			t.csv.Write([]string{"timestamp", "name", "labels", "value"})
+		}
+	} else {
+		t.jsonl = bufio.NewWriter(out)
+	}
+	return t, nil
+}
+
+// longRow is a JSON Lines row of the long layout
+type longRow struct {
+	Timestamp string            `json:"timestamp"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Value     interface{}       `json:"value"`
+}
+
+// Append writes the rows of the samples, or keeps them for the wide layout
+func (t *Table) Append(batch *Batch) error {
+	for _, s := range batch.Samples {
+		name := string(s.Metric[model.MetricNameLabel])
+
+		if t.options.Layout == LayoutWide {
+			column := name + formatLabels(s.Metric)
+			t.columns[column] = true
+			row, ok := t.rows[s.Timestamp]
+			if !ok {
+				row = make(map[string]model.SampleValue)
+				t.rows[s.Timestamp] = row
+			}
+			row[column] = s.Value
+			continue
+		}
+
+		timestamp := s.Timestamp.Time().UTC().Format(timeFormat)
+		if t.csv != nil {
+			if err := t.csv.Write([]string{timestamp, name, formatLabels(s.Metric), formatValue(s.Value)}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		labels := make(map[string]string, len(s.Metric))
+		for n, v := range s.Metric {
+			if n != model.MetricNameLabel {
+				labels[string(n)] = string(v)
+			}
+		}
+		if err := t.writeJSON(longRow{Timestamp: timestamp, Name: name, Labels: labels, Value: jsonValue(s.Value)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered rows of the long layout
+func (t *Table) Flush() error {
+	if t.csv != nil {
+		t.csv.Flush()
+		return t.csv.Error()
+	}
+	return t.jsonl.Flush()
+}
+
+// Close writes the rows of the wide layout, sorted by timestamp with the
+// columns sorted by series, and closes the file
+func (t *Table) Close() error {
+	if t.options.Layout == LayoutWide {
+		if err := t.writeWide(); err != nil {
+			t.out.Close()
+			return err
+		}
+	}
+	if err := t.Flush(); err != nil {
+		t.out.Close()
+		return err
+	}
+	return t.out.Close()
+}
+
+// Capabilities of the tables: float samples only
+func (t *Table) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (t *Table) writeWide() error {
+	columns := make([]string, 0, len(t.columns))
+	for column := range t.columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	timestamps := make([]model.Time, 0, len(t.rows))
+	for ts := range t.rows {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	if t.csv != nil {
+		if err := t.csv.Write(append([]string{"timestamp"}, columns...)); err != nil {
+			return err
+		}
+	}
+	for _, ts := range timestamps {
+		timestamp := ts.Time().UTC().Format(timeFormat)
+		row := t.rows[ts]
+
+		if t.csv != nil {
+			record := []string{timestamp}
+			for _, column := range columns {
+				value := ""
+				if v, ok := row[column]; ok {
+					value = formatValue(v)
+				}
+				record = append(record, value)
+			}
+			if err := t.csv.Write(record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		object := map[string]interface{}{"timestamp": timestamp}
+		for column, value := range row {
+			object[column] = jsonValue(value)
+		}
+		if err := t.writeJSON(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) writeJSON(row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	t.jsonl.Write(data)
+	return t.jsonl.WriteByte('\n')
+}
+
+// jsonValue returns the value as a JSON number, or as a string for NaN and
+// infinite values JSON cannot represent
+func jsonValue(value model.SampleValue) interface{} {
+	f := float64(value)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return formatValue(value)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func tableBatch() *Batch {
+	return &Batch{Samples: model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "db"}, Value: 0, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "temperature", "job": "app"}, Value: model.SampleValue(math.NaN()), Timestamp: 2500},
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 2500},
+	}}
+}
+
+func writeTable(t *testing.T, options TableOptions) string {
+	return writeSink(t, func(output string) (Sink, error) {
+		options.Output = output
+		return NewTable(options)
+	}, tableBatch())
+}
+
+func TestTableLongCSV(t *testing.T) {
+	rows := writeTable(t, TableOptions{Format: FormatCSV, Layout: LayoutLong})
+	assert.Equal(t, `timestamp,name,labels,value
+1970-01-01T00:00:01.000Z,up,"{job=""app""}",1
+1970-01-01T00:00:01.000Z,up,"{job=""db""}",0
+1970-01-01T00:00:02.500Z,temperature,"{job=""app""}",NaN
+1970-01-01T00:00:02.500Z,up,"{job=""app""}",1
+`, rows, "a row should be written for every sample")
+}
+
+func TestTableLongJSONL(t *testing.T) {
+	rows := writeTable(t, TableOptions{Format: FormatJSONL, Layout: LayoutLong})
+	assert.Equal(t, `{"timestamp":"1970-01-01T00:00:01.000Z","name":"up","labels":{"job":"app"},"value":1}
+{"timestamp":"1970-01-01T00:00:01.000Z","name":"up","labels":{"job":"db"},"value":0}
+{"timestamp":"1970-01-01T00:00:02.500Z","name":"temperature","labels":{"job":"app"},"value":"NaN"}
+{"timestamp":"1970-01-01T00:00:02.500Z","name":"up","labels":{"job":"app"},"value":1}
+`, rows, "a line should be written for every sample, NaN as a string")
+}
+
+func TestTableWideCSV(t *testing.T) {
+	rows := writeTable(t, TableOptions{Format: FormatCSV, Layout: LayoutWide})
+	assert.Equal(t, `timestamp,"temperature{job=""app""}","up{job=""app""}","up{job=""db""}"
+1970-01-01T00:00:01.000Z,,1,0
+1970-01-01T00:00:02.500Z,NaN,1,
+`, rows, "a column should be written for every series")
+}
+
+func TestTableWideJSONL(t *testing.T) {
+	rows := writeTable(t, TableOptions{Format: FormatJSONL, Layout: LayoutWide})
+	assert.Equal(t, `{"timestamp":"1970-01-01T00:00:01.000Z","up{job=\"app\"}":1,"up{job=\"db\"}":0}
+{"temperature{job=\"app\"}":"NaN","timestamp":"1970-01-01T00:00:02.500Z","up{job=\"app\"}":1}
+`, rows, "a row should be written for every timestamp")
+}
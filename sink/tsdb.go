@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"time"
+
+	"github.com/Cleafy/promqueen/blocks"
+	"github.com/sirupsen/logrus"
+)
+
+// TSDB writes the samples into Prometheus 2.x TSDB blocks
+type TSDB struct {
+	writer *blocks.Writer
+}
+
+// NewTSDB generates a new TSDB sink creating the blocks under dir
+func NewTSDB(dir string, blockDuration time.Duration) (*TSDB, error) {
+	writer, err := blocks.NewWriter(dir, blockDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &TSDB{writer: writer}, nil
+}
+
+// Append buffers the samples and the native histograms, writing the blocks
+// the input moved past
+func (t *TSDB) Append(batch *Batch) error {
+	discarded, err := t.writer.Append(batch.Samples)
+	if discarded > 0 {
+		logrus.Infof("%d samples discarded", discarded)
+	}
+	if err != nil {
+		return err
+	}
+
+	discarded, err = t.writer.AppendHistograms(batch.Histograms)
+	if discarded > 0 {
+		logrus.Infof("%d histograms discarded", discarded)
+	}
+	return err
+}
+
+// Flush writes all the buffered samples as blocks
+func (t *TSDB) Flush() error {
+	return t.writer.Flush()
+}
+
+// Close writes all the buffered samples as blocks
+func (t *TSDB) Close() error {
+	return t.writer.Close()
+}
+
+// Capabilities of the TSDB blocks: native histograms are written as
+// histogram chunks, exemplars and metadata are not stored in blocks
+func (t *TSDB) Capabilities() Capabilities {
+	return Capabilities{NativeHistograms: true}
+}
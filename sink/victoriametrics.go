@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+)
+
+// VictoriaMetricsOptions configures the VictoriaMetrics sink:
+//  - the URL of the import API (eg. http://victoria:8428/api/v1/import)
+//    along with the extra Headers (eg. Authorization), the Timeout and the
+//    BatchSize (in samples) of the requests; without URL the lines are
+//    written to the Output file
+type VictoriaMetricsOptions struct {
+	Output    string
+	URL       string
+	Headers   map[string]string
+	Timeout   time.Duration
+	BatchSize int
+}
+
+// VictoriaMetrics writes the samples in the JSON lines format of the
+// VictoriaMetrics /api/v1/import API, a line per series of every batch.
+type VictoriaMetrics struct {
+	options VictoriaMetricsOptions
+	client  *http.Client
+	out     io.WriteCloser
+	writer  *bufio.Writer
+	buffer  bytes.Buffer
+	samples int
+}
+
+// NewVictoriaMetrics generates a new VictoriaMetrics sink, creating the
+// output file when no URL is given
+func NewVictoriaMetrics(options VictoriaMetricsOptions) (*VictoriaMetrics, error) {
+	vm := &VictoriaMetrics{
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+	}
+	if options.URL == "" {
+		out, err := createOutput(options.Output)
+		if err != nil {
+			return nil, err
+		}
+		vm.out = out
+		vm.writer = bufio.NewWriter(out)
+	}
+	return vm, nil
+}
+
+// vmLine is a line of the import format
+type vmLine struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []interface{}     `json:"values"`
+	Timestamps []int64           `json:"timestamps"`
+}
+
+// Append writes a line for every series of the batch, or posts the lines as
+// soon as BatchSize samples are buffered. NaN and infinite values cannot be
+// imported and are skipped.
+func (vm *VictoriaMetrics) Append(batch *Batch) error {
+	skipped := 0
+	lines := make([]*vmLine, 0)
+	index := make(map[model.Fingerprint]*vmLine)
+	for _, s := range batch.Samples {
+		value := float64(s.Value)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			skipped++
+			continue
+		}
+
+		fp := s.Metric.Fingerprint()
+		line, ok := index[fp]
+		if !ok {
+			line = &vmLine{Metric: make(map[string]string, len(s.Metric))}
+			for name, value := range s.Metric {
+				if value != "" {
+					line.Metric[string(name)] = string(value)
+				}
+			}
+			index[fp] = line
+			lines = append(lines, line)
+		}
+		line.Values = append(line.Values, jsonValue(s.Value))
+		line.Timestamps = append(line.Timestamps, int64(s.Timestamp))
+	}
+	if skipped > 0 {
+		logrus.Infof("%d NaN or infinite samples skipped", skipped)
+	}
+
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if vm.writer != nil {
+			if _, err := vm.writer.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		vm.buffer.Write(data)
+		if vm.samples += len(line.Values); vm.samples >= vm.options.BatchSize {
+			if err := vm.post(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to the file or posts them
+func (vm *VictoriaMetrics) Flush() error {
+	if vm.writer != nil {
+		return vm.writer.Flush()
+	}
+	return vm.post()
+}
+
+// Close flushes the buffered lines and closes the file
+func (vm *VictoriaMetrics) Close() error {
+	err := vm.Flush()
+	if vm.out != nil {
+		if cerr := vm.out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Capabilities of the import API: float samples only
+func (vm *VictoriaMetrics) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// post posts the buffered lines to the import API
+func (vm *VictoriaMetrics) post() error {
+	if vm.buffer.Len() == 0 {
+		return nil
+	}
+	if err := post(vm.client, vm.options.URL, vm.options.Headers, "application/json", vm.buffer.Bytes()); err != nil {
+		return err
+	}
+	vm.buffer.Reset()
+	vm.samples = 0
+	return nil
+}
@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func vmBatch() *Batch {
+	return &Batch{Samples: model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "db", "zone": ""}, Value: 0, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 2000},
+		{Metric: model.Metric{"__name__": "load", "job": "app"}, Value: model.SampleValue(math.NaN()), Timestamp: 2000},
+	}}
+}
+
+func TestVictoriaMetricsFile(t *testing.T) {
+	data := writeSink(t, func(output string) (Sink, error) {
+		return NewVictoriaMetrics(VictoriaMetricsOptions{Output: output})
+	}, vmBatch())
+	assert.Equal(t, `{"metric":{"__name__":"up","job":"app"},"values":[1,1],"timestamps":[1000,2000]}
+{"metric":{"__name__":"up","job":"db"},"values":[0],"timestamps":[1000]}
+`, string(data), "the samples of every series should be grouped in a line")
+}
+
+func TestVictoriaMetricsHTTP(t *testing.T) {
+	var bodies []string
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	vm, err := NewVictoriaMetrics(VictoriaMetricsOptions{URL: server.URL + "/api/v1/import", BatchSize: 2})
+	assert.Empty(t, err, "should not be any error")
+	assert.Empty(t, vm.Append(vmBatch()), "should not be any error")
+	assert.Empty(t, vm.Close(), "should not be any error")
+	assert.Equal(t, 2, len(bodies), "a request should be sent for every batch")
+	assert.Equal(t, "application/json", contentType, "the lines should be sent as JSON")
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/local"
+	"github.com/prometheus/prometheus/storage/metric"
+)
+
+// Querier returns a querier on the store, making the Store a
+// promql.Queryable
+func (s *Store) Querier() (local.Querier, error) {
+	return querier{s}, nil
+}
+
+// LabelNames returns the sorted label names of all the series
+func (s *Store) LabelNames() model.LabelNames {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	seen := make(map[model.LabelName]struct{})
+	for _, series := range s.series {
+		for name := range series.Metric {
+			seen[name] = struct{}{}
+		}
+	}
+	names := make(model.LabelNames, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Sort(names)
+	return names
+}
+
+// querier implements local.Querier on top of the Store
+type querier struct {
+	s *Store
+}
+
+func (q querier) Close() error {
+	return nil
+}
+
+func (q querier) QueryRange(ctx context.Context, from, through model.Time, matchers ...*metric.LabelMatcher) ([]local.SeriesIterator, error) {
+	return iterators(q.s.Select(from, through, matchers...)), nil
+}
+
+func (q querier) QueryInstant(ctx context.Context, ts model.Time, stalenessDelta time.Duration, matchers ...*metric.LabelMatcher) ([]local.SeriesIterator, error) {
+	return iterators(q.s.Select(ts.Add(-stalenessDelta), ts, matchers...)), nil
+}
+
+func (q querier) MetricsForLabelMatchers(ctx context.Context, from, through model.Time, matcherSets ...metric.LabelMatchers) ([]metric.Metric, error) {
+	var metrics []metric.Metric
+	for _, series := range q.union(from, through, matcherSets) {
+		metrics = append(metrics, metric.Metric{Metric: series.Metric})
+	}
+	return metrics, nil
+}
+
+func (q querier) LastSampleForLabelMatchers(ctx context.Context, cutoff model.Time, matcherSets ...metric.LabelMatchers) (model.Vector, error) {
+	var vector model.Vector
+	for _, series := range q.union(cutoff, model.Latest, matcherSets) {
+		last := series.Samples[len(series.Samples)-1]
+		vector = append(vector, &model.Sample{Metric: series.Metric, Value: last.Value, Timestamp: last.Timestamp})
+	}
+	return vector, nil
+}
+
+func (q querier) LabelValuesForLabelName(ctx context.Context, name model.LabelName) (model.LabelValues, error) {
+	q.s.mtx.RLock()
+	defer q.s.mtx.RUnlock()
+
+	seen := make(map[model.LabelValue]struct{})
+	for _, series := range q.s.series {
+		if value, ok := series.Metric[name]; ok {
+			seen[value] = struct{}{}
+		}
+	}
+	values := make(model.LabelValues, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+	sort.Sort(values)
+	return values, nil
+}
+
+// union selects the series matching any of the matcher sets, the sets
+// matching the empty string being ignored as the local storage does
+func (q querier) union(from, through model.Time, matcherSets []metric.LabelMatchers) []*Series {
+	seen := make(map[model.Fingerprint]struct{})
+	var union []*Series
+	for _, matchers := range matcherSets {
+		empty := true
+		for _, m := range matchers {
+			if !m.MatchesEmptyString() {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+		for _, series := range q.s.Select(from, through, matchers...) {
+			fp := series.Metric.Fingerprint()
+			if _, ok := seen[fp]; !ok {
+				seen[fp] = struct{}{}
+				union = append(union, series)
+			}
+		}
+	}
+	return union
+}
+
+func iterators(series []*Series) []local.SeriesIterator {
+	its := make([]local.SeriesIterator, 0, len(series))
+	for _, s := range series {
+		its = append(its, &iterator{s})
+	}
+	return its
+}
+
+// iterator implements local.SeriesIterator on the samples of a series
+type iterator struct {
+	series *Series
+}
+
+func (it *iterator) ValueAtOrBeforeTime(t model.Time) model.SamplePair {
+	samples := it.series.Samples
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > t })
+	if i == 0 {
+		return model.ZeroSamplePair
+	}
+	return samples[i-1]
+}
+
+func (it *iterator) RangeValues(in metric.Interval) []model.SamplePair {
+	samples := it.series.Samples
+	start := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp >= in.OldestInclusive })
+	end := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > in.NewestInclusive })
+	if start >= end {
+		return nil
+	}
+	return samples[start:end]
+}
+
+func (it *iterator) Metric() metric.Metric {
+	return metric.Metric{Metric: it.series.Metric}
+}
+
+func (it *iterator) Close() {}
@@ -0,0 +1,174 @@
+// Package store keeps the samples decoded from the recordings in memory, so
+// that they can be queried without backfilling them first.
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	cm "github.com/Cleafy/promqueen/model"
+	"github.com/Cleafy/promqueen/playback"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/metric"
+	"github.com/sirupsen/logrus"
+)
+
+// Series is a series along with its samples sorted by timestamp
+type Series struct {
+	Metric  model.Metric
+	Samples []model.SamplePair
+}
+
+// Store holds the series in memory, indexed by metric name. Native
+// histograms are stored as their classic series.
+type Store struct {
+	mtx    sync.RWMutex
+	series map[model.Fingerprint]*Series
+	byName map[model.LabelValue][]*Series
+}
+
+// New generates a new empty Store
+func New() *Store {
+	return &Store{
+		series: make(map[model.Fingerprint]*Series),
+		byName: make(map[model.LabelValue][]*Series),
+	}
+}
+
+// Options configures how Load decodes the frames:
+//  - HonorTimestamps, see playback.Decode
+//  - the Offset the timestamps are moved by, see playback.Shift
+//  - the Filter the series have to pass, nil for none
+type Options struct {
+	HonorTimestamps bool
+	Offset          time.Duration
+	Filter          *playback.Filter
+}
+
+// Load decodes the frames into a new Store, synthetic series (up,
+// scrape_duration_seconds...) included, as promplay backfills them
+func Load(frames <-chan cm.Frame, options Options) *Store {
+	s := New()
+	scrapeSeries := playback.NewScrapeSeries()
+	for frame := range frames {
+		scrape := &playback.Scrape{}
+		if frame.Header.Type != cm.FailureFrame {
+			var err error
+			if scrape, err = playback.Decode(&frame, options.HonorTimestamps); err != nil {
+				logrus.Errorf("Errors occured while reading frame %s, MESSAGE: %v", frame.NameString(), err)
+				continue
+			}
+		}
+		playback.Shift(&frame, scrape, options.Offset)
+		synthetic := scrapeSeries.Samples(&frame, scrape)
+		options.Filter.Scrape(scrape)
+		s.Append(append(scrape.ClassicSamples(), options.Filter.Samples(synthetic)...))
+	}
+	logrus.Infof("%d series loaded", len(s.series))
+	return s
+}
+
+// Append adds the samples to their series, a sample replacing the one of
+// the series with the same timestamp
+func (s *Store) Append(samples model.Vector) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, sample := range samples {
+		fp := sample.Metric.Fingerprint()
+		series, ok := s.series[fp]
+		if !ok {
+			series = &Series{Metric: sample.Metric}
+			s.series[fp] = series
+			name := sample.Metric[model.MetricNameLabel]
+			s.byName[name] = append(s.byName[name], series)
+		}
+
+		pair := model.SamplePair{Timestamp: sample.Timestamp, Value: sample.Value}
+		n := len(series.Samples)
+		if n == 0 || series.Samples[n-1].Timestamp < pair.Timestamp {
+			series.Samples = append(series.Samples, pair)
+			continue
+		}
+		// out of order, recordings are mostly sorted so this is rare
+		i := sort.Search(n, func(i int) bool { return series.Samples[i].Timestamp >= pair.Timestamp })
+		if series.Samples[i].Timestamp == pair.Timestamp {
+			series.Samples[i] = pair
+			continue
+		}
+		series.Samples = append(series.Samples, model.SamplePair{})
+		copy(series.Samples[i+1:], series.Samples[i:])
+		series.Samples[i] = pair
+	}
+}
+
+// Bounds returns the timestamps of the oldest and newest samples, both
+// zero when the store is empty
+func (s *Store) Bounds() (oldest, newest model.Time) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	first := true
+	for _, series := range s.series {
+		if len(series.Samples) == 0 {
+			continue
+		}
+		if from := series.Samples[0].Timestamp; first || from < oldest {
+			oldest = from
+		}
+		if through := series.Samples[len(series.Samples)-1].Timestamp; first || through > newest {
+			newest = through
+		}
+		first = false
+	}
+	return oldest, newest
+}
+
+// Select returns the series matching all the matchers with their samples
+// between from and through (included), the series without samples in the
+// range are left out
+func (s *Store) Select(from, through model.Time, matchers ...*metric.LabelMatcher) []*Series {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var selected []*Series
+	for _, series := range s.candidates(matchers) {
+		if !matches(series.Metric, matchers) {
+			continue
+		}
+		samples := series.Samples
+		start := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp >= from })
+		end := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > through })
+		if start < end {
+			selected = append(selected, &Series{Metric: series.Metric, Samples: samples[start:end]})
+		}
+	}
+	return selected
+}
+
+// candidates returns the series of the metric name when matched exactly,
+// all the series otherwise
+func (s *Store) candidates(matchers []*metric.LabelMatcher) []*Series {
+	for _, m := range matchers {
+		if m.Name == model.MetricNameLabel && m.Type == metric.Equal {
+			return s.byName[m.Value]
+		}
+	}
+	all := make([]*Series, 0, len(s.series))
+	for _, series := range s.series {
+		all = append(all, series)
+	}
+	return all
+}
+
+// matches tells whether the metric matches all the matchers, a missing
+// label matching as an empty one
+func matches(m model.Metric, matchers []*metric.LabelMatcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.Match(m[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
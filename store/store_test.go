@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore() *Store {
+	s := New()
+	s.Append(model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 3000},
+		{Metric: model.Metric{"__name__": "up", "job": "db"}, Value: 0, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "temperature", "job": "app"}, Value: 21, Timestamp: 1000},
+	})
+	s.Append(model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 0, Timestamp: 1000},
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 1, Timestamp: 2000},
+		{Metric: model.Metric{"__name__": "up", "job": "app"}, Value: 5, Timestamp: 2000},
+	})
+	return s
+}
+
+func matcher(t metric.MatchType, name model.LabelName, value model.LabelValue) *metric.LabelMatcher {
+	m, err := metric.NewLabelMatcher(t, name, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestStoreAppendOutOfOrder(t *testing.T) {
+	series := testStore().Select(model.Earliest, model.Latest, matcher(metric.Equal, "job", "app"), matcher(metric.Equal, "__name__", "up"))
+	assert.Equal(t, 1, len(series), "the series should be selected")
+	assert.Equal(t, []model.SamplePair{{Timestamp: 1000, Value: 0}, {Timestamp: 2000, Value: 5}, {Timestamp: 3000, Value: 1}},
+		series[0].Samples, "the samples should be sorted and deduplicated")
+}
+
+func TestStoreSelect(t *testing.T) {
+	s := testStore()
+	series := s.Select(1500, 3000, matcher(metric.Equal, "__name__", "up"))
+	assert.Equal(t, 1, len(series), "the series without samples in the range should be left out")
+	assert.Equal(t, 2, len(series[0].Samples), "only the samples in the range should be returned")
+
+	series = s.Select(model.Earliest, model.Latest, matcher(metric.RegexMatch, "__name__", "up|temp.*"), matcher(metric.NotEqual, "job", "db"))
+	assert.Equal(t, 2, len(series), "the series matching all the matchers should be selected")
+}
+
+func TestStoreBounds(t *testing.T) {
+	oldest, newest := testStore().Bounds()
+	assert.Equal(t, model.Time(1000), oldest, "the oldest timestamp should be returned")
+	assert.Equal(t, model.Time(3000), newest, "the newest timestamp should be returned")
+}
+
+func TestQuerierIterator(t *testing.T) {
+	q, _ := testStore().Querier()
+	its, _ := q.QueryRange(context.Background(), model.Earliest, model.Latest, matcher(metric.Equal, "job", "app"), matcher(metric.Equal, "__name__", "up"))
+	assert.Equal(t, 1, len(its), "the series should be selected")
+	assert.Equal(t, model.SamplePair{Timestamp: 2000, Value: 5}, its[0].ValueAtOrBeforeTime(2500), "the previous sample should be returned")
+	assert.Equal(t, model.ZeroSamplePair, its[0].ValueAtOrBeforeTime(500), "no sample should be returned before the first one")
+	assert.Equal(t, 2, len(its[0].RangeValues(metric.Interval{OldestInclusive: 2000, NewestInclusive: 3000})), "the samples in the interval should be returned")
+
+	values, _ := q.LabelValuesForLabelName(context.Background(), "job")
+	assert.Equal(t, model.LabelValues{"app", "db"}, values, "the label values should be sorted")
+}